@@ -1,8 +1,8 @@
 package main
 
 import (
+	"archive/tar"
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -21,23 +21,52 @@ import (
 )
 
 type Environment struct {
-	Name      string     `json:"name"`
-	Container *Container `json:"container"`
-	Type      string     `json:"type"`
+	Name      string     `json:"name" yaml:"name"`
+	Container *Container `json:"container" yaml:"container"`
+	Type      string     `json:"type" yaml:"type"`
+	Services  []Service  `json:"services" yaml:"services"`
+}
+
+type Snapshot struct {
+	Name    string    `json:"name"`
+	Image   string    `json:"image"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+}
+
+type SnapshotsByCreated []Snapshot
+
+func (a SnapshotsByCreated) Len() int           { return len(a) }
+func (a SnapshotsByCreated) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a SnapshotsByCreated) Less(i, j int) bool { return a[i].Created.Before(a[j].Created) }
+
+type PortsByContainerPort []Port
+
+func (a PortsByContainerPort) Len() int      { return len(a) }
+func (a PortsByContainerPort) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a PortsByContainerPort) Less(i, j int) bool {
+	if a[i].HostIp != a[j].HostIp {
+		return a[i].HostIp < a[j].HostIp
+	}
+	if a[i].Type != a[j].Type {
+		return a[i].Type < a[j].Type
+	}
+	return a[i].ContainerPort < a[j].ContainerPort
 }
 
 type UserImage struct {
-	Name     string
-	EnvCount int
-	EnvList  []string
-	Labels   map[string]string
-	Version  int
+	Name     string            `json:"name" yaml:"name"`
+	EnvCount int               `json:"envCount" yaml:"envCount"`
+	EnvList  []string          `json:"envs" yaml:"envs"`
+	Labels   map[string]string `json:"labels" yaml:"labels"`
+	Version  int               `json:"version" yaml:"version"`
 }
 
 type BaseImage struct {
-	Name        string
-	Description string
-	Tags        []*BaseImageTag
+	Name        string          `json:"name" yaml:"name"`
+	Description string          `json:"description" yaml:"description"`
+	Org         string          `json:"org" yaml:"org"`
+	Tags        []*BaseImageTag `json:"tags" yaml:"tags"`
 }
 
 type ByName []UserImage
@@ -47,9 +76,9 @@ func (a ByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByName) Less(i, j int) bool { return a[i].Name < a[j].Name }
 
 type BaseImageTag struct {
-	Name      string
-	Pulled    bool
-	Preferred bool
+	Name      string `json:"name" yaml:"name"`
+	Pulled    bool   `json:"pulled" yaml:"pulled"`
+	Preferred bool   `json:"preferred" yaml:"preferred"`
 }
 
 type CreateOpts struct {
@@ -60,15 +89,34 @@ type CreateOpts struct {
 	ProjectDir    string
 	ForceBuild    bool
 	VolumeHome    bool
+	DockerSocket  bool
+	Env           []string
+	Provision     []string
+	Mounts        []MountOpts
+	Services      map[string]ServiceSpec
+	Snapshot      string
+	Resources     ResourceOpts
+	Network       string
 	Build         BuildOpts
 }
 
+// MountOpts describes a host path mounted into every environment.  Target is
+// relative to the user's home directory in the container, and Mode is either
+// "ro" or "rw".
+type MountOpts struct {
+	Source string `yaml:"source"`
+	Target string `yaml:"target"`
+	Mode   string `yaml:"mode"`
+}
+
 type BuildOpts struct {
 	Username  string
 	UID, GID  int
 	Image     ImageOpts
 	ForcePull bool
 	TimeZone  string
+	DockerGID int
+	Distro    string
 }
 
 type ImageOpts struct {
@@ -90,11 +138,14 @@ func ParsePorts(portSpecs []string) ([]Port, error) {
 		contPort, proto := portParts[0], portParts[1]
 		cp, _ := strconv.Atoi(contPort)
 		if cp == 22 && proto == "tcp" {
-			return ports, errors.New("bad container port, 22 reserved for ssh")
+			return []Port{}, errors.New("bad container port, 22 reserved for ssh")
 		}
 		for _, binding := range bindings[port] {
+			// ranges of equal length are expanded by ParsePortSpecs, so a
+			// range left here maps several host ports to one container port.
+			// Docker would pick a free one, but a Port has a single host port.
 			if strings.Contains(binding.HostPort, "-") {
-				return ports, errors.New("dynamic port ranges not supported (yet)")
+				return []Port{}, fmt.Errorf("Host port range %s for the single container port %s isn't supported, give one host port or a container range of the same length", binding.HostPort, contPort)
 			}
 			hp, _ := strconv.Atoi(binding.HostPort)
 
@@ -107,9 +158,60 @@ func ParsePorts(portSpecs []string) ([]Port, error) {
 		}
 	}
 
+	sort.Sort(PortsByContainerPort(ports))
+
 	return ports, nil
 }
 
+// CompactPorts formats ports like docker does, with consecutive ports
+// collapsed into ranges, e.g. "8000-8010->8000-8010/tcp".
+func CompactPorts(ports []Port) []string {
+	sorted := make([]Port, len(ports))
+	copy(sorted, ports)
+	sort.Sort(PortsByContainerPort(sorted))
+
+	compact := make([]string, 0)
+	for i := 0; i < len(sorted); {
+		start := sorted[i]
+		end := i
+		for end+1 < len(sorted) {
+			next := sorted[end+1]
+			prev := sorted[end]
+			if next.HostIp != start.HostIp || next.Type != start.Type ||
+				next.ContainerPort != prev.ContainerPort+1 {
+				break
+			}
+			if (prev.HostPort == 0) != (next.HostPort == 0) ||
+				(next.HostPort != 0 && next.HostPort != prev.HostPort+1) {
+				break
+			}
+			end++
+		}
+
+		containerPorts := portRange(start.ContainerPort, sorted[end].ContainerPort)
+		if start.HostPort == 0 {
+			compact = append(compact, fmt.Sprintf("%s/%s", containerPorts, start.Type))
+		} else {
+			hostPorts := portRange(start.HostPort, sorted[end].HostPort)
+			if len(start.HostIp) > 0 && start.HostIp != "0.0.0.0" {
+				hostPorts = fmt.Sprintf("%s:%s", start.HostIp, hostPorts)
+			}
+			compact = append(compact, fmt.Sprintf("%s->%s/%s", hostPorts, containerPorts, start.Type))
+		}
+
+		i = end + 1
+	}
+
+	return compact
+}
+
+func portRange(start, end int64) string {
+	if start == end {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d-%d", start, end)
+}
+
 func DestroyContainer(dc DockerClient, sc SystemClient, envName string) error {
 	logrus.Debugf("Stopping environment")
 	env, err := EnsureStopped(dc, sc, envName)
@@ -122,48 +224,328 @@ func DestroyContainer(dc DockerClient, sc SystemClient, envName string) error {
 		if err != nil {
 			return err
 		}
+
+		err = removeUnusedNetwork(dc, env.Container.Labels["skeg.io/container/network"])
+		if err != nil {
+			return err
+		}
+	}
+
+	return RemoveServices(dc, sc, env)
+}
+
+// CloneEnvironment creates a new environment with the same image, time zone,
+// volumes and settings as an existing one, and a copy of its home directory.
+// Published ports are given new host ports so the two don't collide, unless
+// the clone's host ports are given in co.
+func CloneEnvironment(dc DockerClient, sc SystemClient, src string, co CreateOpts, output *os.File) error {
+	env, err := GetEnvironment(dc, sc, src)
+	if err != nil {
+		return err
+	}
+
+	if env.Container == nil {
+		return errors.New("No container found")
+	}
+
+	envs, err := Environments(dc, sc)
+	if err != nil {
+		return err
+	}
+	if _, ok := envs[co.Name]; ok {
+		return fmt.Errorf("Environment %s already exists", co.Name)
+	}
+
+	co, err = MergeEnvironmentOpts(dc, sc, env, co)
+	if err != nil {
+		return err
+	}
+
+	// host ports given for the clone are kept, the source's would conflict
+	remapped := make([]Port, 0)
+	for _, port := range co.ExistingPorts {
+		port.HostPort = 0
+		remapped = append(remapped, port)
+	}
+	co.ExistingPorts = remapped
+
+	homeDir := fmt.Sprintf("/home/%s", sc.Username())
+	if !co.VolumeHome {
+		srcPath, err := sc.EnsureEnvironmentDir(src)
+		if err != nil {
+			return err
+		}
+
+		dstPath, err := sc.EnsureEnvironmentDir(co.Name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Copying home directory...")
+		err = copyHomeDir(srcPath, dstPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = CreateEnvironment(dc, sc, co, output)
+	if err != nil {
+		return err
+	}
+
+	if co.VolumeHome {
+		fmt.Println("Copying home directory...")
+		containerName := fmt.Sprintf("%s_%s_%s", CONT_PREFIX, sc.Username(), co.Name)
+		err = copyHomeVolume(dc, env.Container.Name, containerName, homeDir)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func FreezeEnvironment(dc DockerClient, sc SystemClient, envName string) error {
+// RenameEnvironment gives an environment a new name.  The container is
+// recreated with the new name and hostname, keeping its ports, volumes and
+// settings, and the home directory is moved over.  As with a rebuild, changes
+// to the container outside of the home directory are not kept.  A running
+// environment is only renamed if force is set.
+func RenameEnvironment(dc DockerClient, sc SystemClient, oldName string, co CreateOpts, force bool, output *os.File) error {
+	env, err := GetEnvironment(dc, sc, oldName)
+	if err != nil {
+		return err
+	}
 
-	env, err := GetEnvironment(dc, sc, envName)
+	envs, err := Environments(dc, sc)
+	if err != nil {
+		return err
+	}
+	if _, ok := envs[co.Name]; ok {
+		return fmt.Errorf("Environment %s already exists", co.Name)
+	}
+
+	if env.Container == nil {
+		logrus.Debugf("No container, renaming environment directory")
+		err = sc.RenameEnvironmentDir(oldName, co.Name)
+		if err != nil {
+			return err
+		}
+
+		return removeHostKey(sc, oldName)
+	}
+
+	running := env.Container.Running
+	if running && !force {
+		return fmt.Errorf("Environment %s is running, stop it first or use --force", oldName)
+	}
+
+	co, err = MergeEnvironmentOpts(dc, sc, env, co)
 	if err != nil {
 		return err
 	}
 
-	path, err := sc.EnsureEnvironmentDir(envName)
+	logrus.Debugf("Stopping environment")
+	env, err = EnsureStopped(dc, sc, oldName)
 	if err != nil {
 		return err
 	}
 
-	// save the env info into a json file
-	data, err := json.MarshalIndent(env, "", "    ")
+	if co.VolumeHome {
+		// named volumes can't be renamed, so copy the data out of the old
+		// container before removing it along with its volume
+		err = CreateEnvironment(dc, sc, co, output)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Copying home directory...")
+		homeDir := fmt.Sprintf("/home/%s", sc.Username())
+		containerName := fmt.Sprintf("%s_%s_%s", CONT_PREFIX, sc.Username(), co.Name)
+		err = copyHomeVolume(dc, env.Container.Name, containerName, homeDir)
+		if err != nil {
+			return err
+		}
+
+		err = DestroyEnvironment(dc, sc, oldName)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = DestroyContainer(dc, sc, oldName)
+		if err != nil {
+			return err
+		}
+
+		logrus.Debugf("Renaming environment directory")
+		err = sc.RenameEnvironmentDir(oldName, co.Name)
+		if err != nil {
+			return err
+		}
+
+		err = removeHostKey(sc, oldName)
+		if err != nil {
+			return err
+		}
+
+		err = CreateEnvironment(dc, sc, co, output)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !running {
+		_, err = EnsureStopped(dc, sc, co.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// snapshotNameRegex matches the names allowed for snapshots, which are used as
+// the image tag.
+var snapshotNameRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+func snapshotRepository(sc SystemClient, envName string) string {
+	return fmt.Sprintf("%s-snap-%s-%s", CONT_PREFIX, sc.Username(), strings.ToLower(envName))
+}
+
+// SnapshotEnvironment commits the environment's container to an image so it
+// can later be restored with RollbackEnvironment.  If name is empty, a
+// timestamp is used.
+func SnapshotEnvironment(dc DockerClient, sc SystemClient, envName, name string) (Snapshot, error) {
+	env, err := GetEnvironment(dc, sc, envName)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if env.Container == nil {
+		return Snapshot{}, errors.New("No container found")
+	}
+
+	now := time.Now()
+	if len(name) == 0 {
+		name = now.Format("20060102150405")
+	}
+	if !snapshotNameRegex.MatchString(name) {
+		return Snapshot{}, fmt.Errorf("Invalid snapshot name %s", name)
+	}
+
+	snapshots, err := Snapshots(dc, sc, envName)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	for _, snap := range snapshots {
+		if snap.Name == name {
+			return Snapshot{}, fmt.Errorf("Snapshot %s already exists", name)
+		}
+	}
+
+	repo := snapshotRepository(sc, envName)
+	labels := map[string]string{
+		"skeg.io/snapshot/env":      envName,
+		"skeg.io/snapshot/username": sc.Username(),
+		"skeg.io/snapshot/name":     name,
+	}
+
+	logrus.Debugf("Committing container %s to %s:%s", env.Container.Name, repo, name)
+	err = dc.CommitContainer(env.Container.Name, repo, name, labels)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return Snapshot{
+		Name:    name,
+		Image:   fmt.Sprintf("%s:%s", repo, name),
+		Created: now,
+	}, nil
+}
+
+// Snapshots returns the snapshots of an environment, oldest first.
+func Snapshots(dc DockerClient, sc SystemClient, envName string) ([]Snapshot, error) {
+	snapshots := make([]Snapshot, 0)
+
+	images, err := dc.ListImagesWithLabels([]string{
+		fmt.Sprintf("skeg.io/snapshot/env=%s", envName),
+		fmt.Sprintf("skeg.io/snapshot/username=%s", sc.Username()),
+	})
+	if err != nil {
+		return snapshots, err
+	}
+
+	for _, im := range images {
+		if im.Labels["skeg.io/snapshot/env"] != envName || im.Labels["skeg.io/snapshot/username"] != sc.Username() {
+			continue
+		}
+		if len(im.RepoTags) == 0 {
+			continue
+		}
+
+		snapshots = append(snapshots, Snapshot{
+			Name:    im.Labels["skeg.io/snapshot/name"],
+			Image:   im.RepoTags[0],
+			Created: time.Unix(im.Created, 0),
+			Size:    im.Size,
+		})
+	}
+
+	sort.Sort(SnapshotsByCreated(snapshots))
+
+	return snapshots, nil
+}
+
+// RollbackEnvironment recreates the environment's container from a snapshot,
+// keeping its ports, volumes and settings.
+func RollbackEnvironment(dc DockerClient, sc SystemClient, co CreateOpts, snapshot string, output *os.File) error {
+	snapshots, err := Snapshots(dc, sc, co.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, snap := range snapshots {
+		if snap.Name == snapshot {
+			co.Snapshot = snap.Image
+			return RebuildEnvironment(dc, sc, co, output)
+		}
+	}
+
+	return fmt.Errorf("Snapshot %s not found for %s", snapshot, co.Name)
+}
+
+// FreezeEnvironment archives an environment to a file at path, then destroys
+// it.  The environment can be brought back with ThawEnvironment.
+func FreezeEnvironment(dc DockerClient, sc SystemClient, envName, path string, includeImage bool) error {
+	file, err := os.Create(path)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Saving environment metadata...")
-	ioutil.WriteFile(filepath.Join(path, "skeg.json"), data, 0644)
+	err = ExportEnvironment(dc, sc, envName, file, includeImage)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
+		os.Remove(path)
 		return err
 	}
 
-	// destroy the container
-	fmt.Println("Destroying container...")
-	err = DestroyContainer(dc, sc, envName)
+	fmt.Println("Destroying environment...")
+	err = DestroyEnvironment(dc, sc, envName)
 	if err != nil {
 		return err
 	}
 
-	// tarball it up
-	fmt.Printf("Tarballing up files...skipping tarball creation, env directory is %s.\n", path)
+	fmt.Printf("Environment frozen to %s\n", path)
 
 	return nil
 }
 
+// ThawEnvironment recreates an environment frozen by FreezeEnvironment.
+func ThawEnvironment(dc DockerClient, sc SystemClient, path string, mounts []MountOpts, output *os.File) error {
+	return ImportEnvironment(dc, sc, path, "", mounts, output)
+}
+
 func DestroyEnvironment(dc DockerClient, sc SystemClient, envName string) error {
 	err := DestroyContainer(dc, sc, envName)
 	if err != nil {
@@ -181,6 +563,12 @@ func DestroyEnvironment(dc DockerClient, sc SystemClient, envName string) error
 		return err
 	}
 
+	logrus.Debugf("Removing host key")
+	err = removeHostKey(sc, envName)
+	if err != nil {
+		return err
+	}
+
 	volumeName := fmt.Sprintf("%s_%s_%s", CONT_PREFIX, sc.Username(), envName)
 	logrus.Debugf("removing docker volume (%s), if it exists", volumeName)
 
@@ -198,6 +586,14 @@ func DestroyEnvironment(dc DockerClient, sc SystemClient, envName string) error
 		}
 	}
 
+	logrus.Debugf("Removing service volumes")
+	err = RemoveServiceVolumes(dc, sc, envName)
+	if err != nil {
+		return err
+	}
+
+	refreshSSHConfig(dc, sc)
+
 	return nil
 }
 
@@ -207,16 +603,76 @@ func RebuildEnvironment(dc DockerClient, sc SystemClient, co CreateOpts, output
 		return err
 	}
 
-	// fmt.Println(co)
-	// fmt.Println(env)
+	if env.Container == nil {
+		return errors.New("No container found")
+	}
+
+	co, err = MergeEnvironmentOpts(dc, sc, env, co)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("Stopping environment")
+	_, err = EnsureStopped(dc, sc, env.Name)
+	if err != nil {
+		return err
+	}
+
+	if env.Container != nil {
+		err = dc.RemoveContainer(env.Container.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	logrus.Debugf("Removing services")
+	err = RemoveServices(dc, sc, env)
+	if err != nil {
+		return err
+	}
+
+	err = CreateEnvironment(dc, sc, co, output)
+	if err != nil {
+		return err
+	}
+
+	// the environment may have moved to another network
+	return removeUnusedNetwork(dc, env.Container.Labels["skeg.io/container/network"])
+}
+
+// MergeEnvironmentOpts fills in create options from an existing environment's
+// container, so the environment can be recreated with the same ports,
+// volumes, image and settings.  Options already set in co take precedence.
+func MergeEnvironmentOpts(dc DockerClient, sc SystemClient, env Environment, co CreateOpts) (CreateOpts, error) {
+	var err error
+
+	if projectDir, ok := env.Container.Labels["skeg.io/container/project_dir"]; ok {
+		logrus.Debugf("Re-reading project spec from %s", projectDir)
+		co.ProjectDir = projectDir
+		co, err = ApplyProjectSpec(co)
+		if err != nil {
+			return co, err
+		}
+	}
 
-	// TODO: check for re-specifying the same port
 	logrus.Debugf("Merge in ports")
+	newPorts, err := ParsePorts(co.Ports)
+	if err != nil {
+		return co, err
+	}
+	respecified := make(map[string]bool)
+	for _, port := range newPorts {
+		respecified[fmt.Sprintf("%d/%s", port.ContainerPort, port.Type)] = true
+	}
+
 	ports := make([]Port, 0)
 	for _, port := range env.Container.Ports {
 		if port.ContainerPort == 22 {
 			continue
 		}
+		if respecified[fmt.Sprintf("%d/%s", port.ContainerPort, port.Type)] {
+			continue
+		}
 		if port.HostPort > 30000 {
 			port.HostPort = 0
 		}
@@ -224,20 +680,53 @@ func RebuildEnvironment(dc DockerClient, sc SystemClient, co CreateOpts, output
 	}
 	co.ExistingPorts = ports
 
-	// TODO: check for re-specifying the same volume
 	logrus.Debugf("Merge in volumes")
 	dockerContainer, err := dc.InspectContainer(env.Container.Name)
 	if err != nil {
-		return err
+		return co, err
 	}
 
+	homeDir := fmt.Sprintf("/home/%s", sc.Username())
+	destinations := map[string]bool{
+		homeDir:                true,
+		"/var/run/docker.sock": true,
+	}
+	if len(co.ProjectDir) > 0 {
+		destinations[projectMountPath(homeDir, co.ProjectDir)] = true
+	}
+	for _, v := range co.Volumes {
+		volumeParts := strings.Split(v, ":")
+		if len(volumeParts) > 1 {
+			destinations[volumeParts[1]] = true
+		}
+	}
+
+	// global mounts are re-added from the current config, so skip both the
+	// ones the container was created with and the ones configured now
+	if globalMounts, ok := env.Container.Labels["skeg.io/container/global_mounts"]; ok && len(globalMounts) > 0 {
+		for _, dest := range strings.Split(globalMounts, ",") {
+			destinations[dest] = true
+		}
+	}
+	for _, mount := range co.Mounts {
+		destinations[mountTarget(homeDir, mount)] = true
+	}
+
+	// a project spec lists all of the environment's volumes, so the old
+	// mounts are only kept without one, and volumes removed from it go
+	_, fromSpec := env.Container.Labels["skeg.io/container/project_dir"]
+
 	volumes := co.Volumes
 	for _, mount := range dockerContainer.Mounts {
-		if mount.Destination == fmt.Sprintf("/home/%s", sc.Username()) {
+		if fromSpec || destinations[mount.Destination] {
 			continue
 		}
 
-		volumes = append(volumes, fmt.Sprintf("%s:%s", mount.Source, mount.Destination))
+		if mount.RW {
+			volumes = append(volumes, fmt.Sprintf("%s:%s", mount.Source, mount.Destination))
+		} else {
+			volumes = append(volumes, fmt.Sprintf("%s:%s:ro", mount.Source, mount.Destination))
+		}
 	}
 	co.Volumes = volumes
 
@@ -258,22 +747,20 @@ func RebuildEnvironment(dc DockerClient, sc SystemClient, co CreateOpts, output
 		co.VolumeHome = (volumeHome == "true")
 	}
 
-	// fmt.Println(co)
-
-	logrus.Debugf("Stopping environment")
-	_, err = EnsureStopped(dc, sc, env.Name)
-	if err != nil {
-		return err
+	if dockerSocket, ok := env.Container.Labels["skeg.io/container/docker"]; ok {
+		co.DockerSocket = co.DockerSocket || (dockerSocket == "true")
 	}
 
-	if env.Container != nil {
-		err = dc.RemoveContainer(env.Container.Name)
-		if err != nil {
-			return err
-		}
+	co.Resources = co.Resources.Merge(resourceOptsFromLabels(env.Container.Labels))
+
+	// variables given again, or in the project spec, replace the old values
+	co.Env = mergeEnv(envFromLabels(env.Container.Labels), co.Env)
+
+	if len(co.Network) == 0 {
+		co.Network = env.Container.Labels["skeg.io/container/network"]
 	}
 
-	return CreateEnvironment(dc, sc, co, output)
+	return co, nil
 }
 
 func CreateEnvironment(dc DockerClient, sc SystemClient, co CreateOpts, output *os.File) error {
@@ -281,6 +768,11 @@ func CreateEnvironment(dc DockerClient, sc SystemClient, co CreateOpts, output *
 	if err != nil {
 		return err
 	}
+
+	limits, err := co.Resources.Limits()
+	if err != nil {
+		return err
+	}
 	ports = append(ports, Port{
 		"", 0, 22, "tcp",
 	})
@@ -292,9 +784,40 @@ func CreateEnvironment(dc DockerClient, sc SystemClient, co CreateOpts, output *
 		return err
 	}
 
+	publicKey, err := ioutil.ReadFile(key.publicPath)
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := KeyFingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+
+	var dockerSocket string
+	if co.DockerSocket {
+		dockerSocket = dockerSocketPath()
+		if dockerEndpointIsLocal() {
+			co.Build.DockerGID, err = sc.DockerSocketGID(dockerSocket)
+			if err != nil {
+				return err
+			}
+		} else {
+			logrus.Warnf("Unable to detect docker socket group on a remote docker host, docker may need sudo inside the environment")
+		}
+	}
+
 	var imageName string
 	userImages, err := UserImages(dc, sc, co.Build.Image, IMAGE_VERSION)
-	if co.ForceBuild || len(userImages) == 0 {
+	userImages = filterImagesForUser(userImages, sc)
+	userImages = filterImagesByLabel(userImages, "skeg.io/image/key_fingerprint", fingerprint)
+	if co.Build.DockerGID > 0 {
+		userImages = filterImagesByLabel(userImages, "skeg.io/image/docker_gid", fmt.Sprintf("%d", co.Build.DockerGID))
+	}
+	if len(co.Snapshot) > 0 {
+		imageName = co.Snapshot
+		logrus.Infof("Using snapshot image %s", imageName)
+	} else if co.ForceBuild || len(userImages) == 0 {
 
 		// TODO: consider whether this is the best default (new image inherits
 		// previous image's time zone)
@@ -344,60 +867,225 @@ func CreateEnvironment(dc DockerClient, sc SystemClient, co CreateOpts, output *
 		}
 
 		if !volumeFound {
-			dc.CreateVolume(CreateVolumeOpts{Name: volumeName, Labels: map[string]string{"skeg": "true"}})
+			err = dc.CreateVolume(CreateVolumeOpts{
+				Name: volumeName,
+				Labels: map[string]string{
+					"skeg":                "true",
+					"skeg.io/volume/user": sc.Username(),
+					"skeg.io/volume/env":  co.Name,
+				},
+			})
 			if err != nil {
 				return err
 			}
 		}
-		volumes = append(volumes, fmt.Sprintf("%s:%s", volumeName, homeDir))
-	} else {
-		volumes = append(volumes, fmt.Sprintf("%s:%s", path, homeDir))
+		volumes = append(volumes, fmt.Sprintf("%s:%s", volumeName, homeDir))
+	} else {
+		volumes = append(volumes, fmt.Sprintf("%s:%s", path, homeDir))
+	}
+	labels["skeg.io/container/volume_home"] = fmt.Sprintf("%v", co.VolumeHome)
+	if co.DockerSocket {
+		volumes = append(volumes, fmt.Sprintf("%s:/var/run/docker.sock", dockerSocket))
+	}
+	labels["skeg.io/container/docker"] = fmt.Sprintf("%v", co.DockerSocket)
+	labels["skeg.io/container/host_key"] = "true"
+	if len(co.ProjectDir) > 0 {
+		volumes = append(volumes, fmt.Sprintf("%s:%s", co.ProjectDir, projectMountPath(homeDir, co.ProjectDir)))
+		labels["skeg.io/container/project_dir"] = co.ProjectDir
+	}
+
+	fileTargets := make(map[string]bool)
+	globalMounts := make([]string, 0)
+	for _, mount := range co.Mounts {
+		volume, isFile, err := mountVolume(homeDir, mount)
+		if err != nil {
+			return err
+		}
+		if len(volume) == 0 {
+			continue
+		}
+
+		target := mountTarget(homeDir, mount)
+		fileTargets[target] = isFile
+		globalMounts = append(globalMounts, target)
+		volumes = append(volumes, volume)
+	}
+	labels["skeg.io/container/global_mounts"] = strings.Join(globalMounts, ",")
+	addResourceLabels(labels, co.Resources)
+	err = addEnvLabel(labels, co.Env)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range volumes {
+		logrus.Debugf("Checking volume %s for local paths", v)
+		if strings.Contains(v, ":") {
+			volumeParts := strings.Split(v, ":")
+			if strings.HasPrefix(volumeParts[1], homeDir) {
+				localPath := strings.Replace(volumeParts[1], homeDir, path, 1)
+				if fileTargets[volumeParts[1]] {
+					// files need a file to mount over, not a directory
+					logrus.Debugf("Making local file '%s'", localPath)
+					err := ensureFile(localPath)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				logrus.Debugf("Making local path '%s'", localPath)
+				err := os.MkdirAll(localPath, 0755)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	network := co.Network
+	if len(network) == 0 {
+		network = userNetworkName(sc)
+	}
+	err = ensureNetwork(dc, network)
+	if err != nil {
+		return err
+	}
+	labels["skeg.io/container/network"] = network
+
+	containerName := fmt.Sprintf("%s_%s_%s", CONT_PREFIX, sc.Username(), co.Name)
+	ccont := CreateContainerOpts{
+		Name:      containerName,
+		Image:     imageName,
+		Hostname:  co.Name,
+		Ports:     ports,
+		Volumes:   volumes,
+		Labels:    labels,
+		Env:       co.Env,
+		Resources: limits,
+		Network:   network,
+		Aliases:   []string{co.Name},
+	}
+	err = dc.CreateContainer(ccont)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("Installing host key")
+	err = installHostKey(dc, sc, co.Name, containerName)
+	if err != nil {
+		return err
+	}
+
+	if len(co.Env) > 0 {
+		logrus.Debugf("Installing environment variables for ssh sessions")
+		err = installEnv(dc, containerName, co.Env)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(co.Services) > 0 {
+		logrus.Debugf("Creating services")
+		err = CreateServices(dc, sc, co.Name, co.Services, output)
+		if err != nil {
+			return err
+		}
+
+		err = dc.ConnectNetwork(envNetworkName(sc, co.Name), containerName, []string{co.Name})
+		if err != nil {
+			return err
+		}
+	}
+
+	logrus.Debugf("Starting container")
+	_, err = EnsureRunning(dc, sc, co.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(co.Provision) > 0 {
+		return ProvisionEnvironment(dc, sc, co.Name, co.Provision)
+	}
+
+	return nil
+}
+
+// ProvisionEnvironment runs each of the provisioning steps, in order, inside
+// the environment as the user.
+func ProvisionEnvironment(dc DockerClient, sc SystemClient, name string, steps []string) error {
+	for _, step := range steps {
+		fmt.Printf("Provisioning: %s\n", step)
+		err := ConnectEnvironment(dc, sc, name, []string{step})
+		if err != nil {
+			return fmt.Errorf("Provisioning step '%s' failed: %s", step, err)
+		}
 	}
-	labels["skeg.io/container/volume_home"] = fmt.Sprintf("%v", co.VolumeHome)
-	workdirParts := strings.Split(co.ProjectDir, string(os.PathSeparator))
-	if len(co.ProjectDir) > 0 {
-		volumes = append(volumes, fmt.Sprintf("%s:%s/%s", co.ProjectDir, homeDir, workdirParts[len(workdirParts)-1]))
+
+	return nil
+}
+
+// mountTarget returns where in the container a global mount is mounted.
+func mountTarget(homeDir string, mount MountOpts) string {
+	target := mount.Target
+	if len(target) == 0 {
+		target = filepath.Base(mount.Source)
 	}
 
-	for _, v := range volumes {
-		logrus.Debugf("Checking volume %s for local paths", v)
-		if strings.Contains(v, ":") {
-			volumeParts := strings.Split(v, ":")
-			if strings.HasPrefix(volumeParts[1], homeDir) {
-				localPath := strings.Replace(volumeParts[1], homeDir, path, 1)
-				logrus.Debugf("Making local path '%s'", localPath)
-				err := os.MkdirAll(localPath, 0755)
-				if err != nil {
-					return err
-				}
-			}
-		}
+	return fmt.Sprintf("%s/%s", homeDir, strings.TrimPrefix(filepath.ToSlash(target), "/"))
+}
+
+// mountVolume turns a global mount into a docker volume spec.  Missing source
+// paths are skipped, so an empty volume is returned for them.
+func mountVolume(homeDir string, mount MountOpts) (string, bool, error) {
+	mode := mount.Mode
+	if len(mode) == 0 {
+		mode = "ro"
+	}
+	if mode != "ro" && mode != "rw" {
+		return "", false, fmt.Errorf("Bad mode '%s' for mount %s, must be ro or rw", mount.Mode, mount.Source)
 	}
 
-	containerName := fmt.Sprintf("%s_%s_%s", CONT_PREFIX, sc.Username(), co.Name)
-	ccont := CreateContainerOpts{
-		Name:     containerName,
-		Image:    imageName,
-		Hostname: co.Name,
-		Ports:    ports,
-		Volumes:  volumes,
-		Labels:   labels,
+	source, err := expandHome(mount.Source)
+	if err != nil {
+		return "", false, err
 	}
-	err = dc.CreateContainer(ccont)
+
+	info, err := os.Stat(source)
+	if os.IsNotExist(err) {
+		logrus.Warnf("Skipping mount of %s, it doesn't exist", source)
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	return fmt.Sprintf("%s:%s:%s", source, mountTarget(homeDir, mount), mode), !info.IsDir(), nil
+}
+
+func ensureFile(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
 	if err != nil {
 		return err
 	}
 
-	logrus.Debugf("Starting container")
-	_, err = EnsureRunning(dc, sc, co.Name)
+	file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0644)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return file.Close()
+}
+
+// projectMountPath returns where in the container the project directory is
+// mounted.
+func projectMountPath(homeDir, projectDir string) string {
+	workdirParts := strings.Split(projectDir, string(os.PathSeparator))
+	return fmt.Sprintf("%s/%s", homeDir, workdirParts[len(workdirParts)-1])
 }
 
 func CreateNewEnvironment(dc DockerClient, sc SystemClient, co CreateOpts, output *os.File) error {
+	if len(co.Name) == 0 {
+		return errors.New("No environment name given, specify one or add it to the project file")
+	}
+
 	logrus.Debugf("Checking if environment already exists")
 	envs, err := Environments(dc, sc)
 	if err != nil {
@@ -423,11 +1111,24 @@ func EnsureRunning(dc DockerClient, sc SystemClient, envName string) (Environmen
 		return env, fmt.Errorf("Environment %s doesn't exist.", envName)
 	}
 
+	for _, svc := range env.Services {
+		if !svc.Running {
+			logrus.Debugf("Starting service %s", svc.Name)
+			err = dc.StartContainer(svc.Container)
+			if err != nil {
+				return env, err
+			}
+		}
+	}
+
 	if env.Container != nil && !env.Container.Running {
 		err = dc.StartContainer(env.Container.Name)
 		if err != nil {
 			return env, err
 		}
+
+		// the ssh port may have changed
+		defer refreshSSHConfig(dc, sc)
 	}
 
 	return GetEnvironment(dc, sc, envName)
@@ -446,20 +1147,39 @@ func EnsureStopped(dc DockerClient, sc SystemClient, envName string) (Environmen
 		return env, fmt.Errorf("Environment %s doesn't exist.", envName)
 	}
 
+	// forwards go through the container's sshd, so they end with it
+	logrus.Debugf("Removing port forwards")
+	err = RemoveForwards(sc, envName)
+	if err != nil {
+		return env, err
+	}
+
 	if env.Container != nil && env.Container.Running {
 		err = dc.StopContainer(env.Container.Name)
 		if err != nil {
 			return env, err
 		}
+
+		defer refreshSSHConfig(dc, sc)
+	}
+
+	for _, svc := range env.Services {
+		if svc.Running {
+			logrus.Debugf("Stopping service %s", svc.Name)
+			err = dc.StopContainer(svc.Container)
+			if err != nil {
+				return env, err
+			}
+		}
 	}
 
 	return GetEnvironment(dc, sc, envName)
 }
 
-func ResolveImage(dc DockerClient, io ImageOpts) (string, error) {
+func ResolveImage(dc DockerClient, sc SystemClient, io ImageOpts) (string, error) {
 	var image string
 	if len(io.Type) > 0 {
-		baseImages, err := BaseImages(dc)
+		baseImages, err := BaseImages(dc, sc)
 		if err != nil {
 			return "", err
 		}
@@ -478,7 +1198,7 @@ func ResolveImage(dc DockerClient, io ImageOpts) (string, error) {
 			if io.Type == im.Name {
 				for _, tag := range im.Tags {
 					if matcher(tag) {
-						image = fmt.Sprintf("%s/%s:%s", DOCKER_HUB_ORG, im.Name, tag.Name)
+						image = fmt.Sprintf("%s/%s:%s", im.Org, im.Name, tag.Name)
 					}
 				}
 			}
@@ -496,7 +1216,7 @@ func ResolveImage(dc DockerClient, io ImageOpts) (string, error) {
 func BuildImage(dc DockerClient, sc SystemClient, key SSHKey, bo BuildOpts, output *os.File) (string, error) {
 	var err error
 	logrus.Debugf("Figuring out which image to use")
-	image, err := ResolveImage(dc, bo.Image)
+	image, err := ResolveImage(dc, sc, bo.Image)
 	if err != nil {
 		return "", err
 	}
@@ -512,15 +1232,25 @@ func BuildImage(dc DockerClient, sc SystemClient, key SSHKey, bo BuildOpts, outp
 		return "", err
 	}
 
+	var distro Distro
+	if len(bo.Distro) > 0 {
+		distro, err = GetDistro(bo.Distro)
+	} else {
+		logrus.Debugf("Detecting distribution")
+		distro, err = DetectDistro(dc, image)
+	}
+	if err != nil {
+		return "", err
+	}
+
 	now := time.Now()
 
 	logrus.Debugf("Building image")
 	dockerfileTmpl := `FROM {{ .Image }}
 
-RUN (addgroup --gid {{ .Gid }} {{ .Username }} || /bin/true) && \
-    adduser --uid {{ .Uid }} --gid {{ .Gid }} {{ .Username }} --gecos "" --disabled-password && \
+RUN {{ .UserSet }} && \
     echo "{{ .Username }}   ALL=NOPASSWD: ALL" >> /etc/sudoers && \
-    echo "AuthorizedKeysFile .ssh/authorized_keys .ssh/authorized_keys2 /etc/ssh/keys/%u/authorized_keys" >> /etc/ssh/sshd_config
+    {{ .SshdSet }}
 
 COPY ssh_pub /etc/ssh/keys/{{ .Username }}/authorized_keys
 RUN chown -R {{ .Uid }}:{{ .Gid }} /etc/ssh/keys/{{ .Username }}/ && \
@@ -528,26 +1258,49 @@ RUN chown -R {{ .Uid }}:{{ .Gid }} /etc/ssh/keys/{{ .Username }}/ && \
 
 {{ .TzSet }}
 
+{{ .DockerGroupSet }}
+
 LABEL skeg.io/image/username={{ .Username }} \
       skeg.io/image/gid={{ .Gid }} \
+      skeg.io/image/docker_gid={{ .DockerGid }} \
       skeg.io/image/uid={{ .Uid }} \
       skeg.io/image/base={{ .Image }} \
+      skeg.io/image/distro={{ .Distro }} \
       skeg.io/image/buildtime="{{ .Time }}" \
       skeg.io/image/timezone="{{ .Tz }}" \
+      skeg.io/image/key_fingerprint="{{ .KeyFingerprint }}" \
       skeg.io/image/version="{{ .Version }}"
 
 `
-	// TODO: make timezone setting work on other distributions
 	var tzenv string
 	if len(bo.TimeZone) > 0 {
-		tzenv = fmt.Sprintf(`RUN ln -sf /usr/share/zoneinfo/%s /etc/localtime && dpkg-reconfigure --frontend noninteractive tzdata`, bo.TimeZone)
+		tzenv = fmt.Sprintf("RUN %s", distro.tzSet(bo.TimeZone))
+	}
+
+	// the group may already exist in the image under another name, so add the
+	// user to whatever group has the socket's gid
+	var dockerGroup string
+	if bo.DockerGID > 0 {
+		dockerGroup = fmt.Sprintf("RUN %s", distro.dockerGroupSet(bo.Username, bo.DockerGID))
+	}
+
+	data, err := ioutil.ReadFile(key.publicPath)
+	if err != nil {
+		return "", err
+	}
+
+	fingerprint, err := KeyFingerprint(data)
+	if err != nil {
+		return "", err
 	}
 
 	dockerfileData := struct {
-		Username, Image, Time, TzSet, Tz string
-		Uid, Gid, Version                int
+		Username, Image, Distro, Time, TzSet, Tz, DockerGroupSet, UserSet, SshdSet, KeyFingerprint string
+		Uid, Gid, DockerGid, Version                                                               int
 	}{
-		bo.Username, image, now.Format(time.UnixDate), tzenv, bo.TimeZone, bo.UID, bo.GID, IMAGE_VERSION,
+		bo.Username, image, distro.Name, now.Format(time.UnixDate), tzenv, bo.TimeZone, dockerGroup,
+		distro.userSet(bo.Username, bo.UID, bo.GID), distro.sshdSet, fingerprint,
+		bo.UID, bo.GID, bo.DockerGID, IMAGE_VERSION,
 	}
 
 	tmpl := template.Must(template.New("dockerfile").Parse(dockerfileTmpl))
@@ -560,11 +1313,6 @@ LABEL skeg.io/image/username={{ .Username }} \
 
 	imageName := fmt.Sprintf("%s-%s-%s", CONT_PREFIX, bo.Username, now.Format("20060102150405"))
 
-	data, err := ioutil.ReadFile(key.publicPath)
-	if err != nil {
-		return "", err
-	}
-
 	err = dc.BuildImage(imageName, dockerfileBytes.String(), string(data), output)
 
 	if err != nil {
@@ -584,7 +1332,7 @@ func UserImages(dc DockerClient, sc SystemClient, io ImageOpts, version int) ([]
 			fmt.Sprintf("skeg.io/image/username=%s", sc.Username()),
 		}
 	} else {
-		image, err := ResolveImage(dc, io)
+		image, err := ResolveImage(dc, sc, io)
 		if err != nil {
 			return images, err
 		}
@@ -626,6 +1374,11 @@ func UserImages(dc DockerClient, sc SystemClient, io ImageOpts, version int) ([]
 	for _, dockerImage := range dockerImages {
 		tags := dockerImage.RepoTags
 
+		// snapshots inherit the user image labels, but aren't user images
+		if _, ok := dockerImage.Labels["skeg.io/snapshot/env"]; ok {
+			continue
+		}
+
 		imageVersion := 0
 		if ver, ok := dockerImage.Labels["skeg.io/image/version"]; ok {
 			imageVersion, _ = strconv.Atoi(ver)
@@ -646,14 +1399,47 @@ func UserImages(dc DockerClient, sc SystemClient, io ImageOpts, version int) ([]
 	return images, nil
 }
 
+func filterImagesByLabel(images []UserImage, label, value string) []UserImage {
+	filtered := make([]UserImage, 0)
+	for _, im := range images {
+		if im.Labels[label] == value {
+			filtered = append(filtered, im)
+		}
+	}
+
+	return filtered
+}
+
+// filterImagesForUser drops images built for a different uid or gid, such as
+// those loaded from an archive made on another machine.
+func filterImagesForUser(images []UserImage, sc SystemClient) []UserImage {
+	filtered := make([]UserImage, 0)
+	for _, im := range images {
+		if uid, ok := im.Labels["skeg.io/image/uid"]; ok && uid != strconv.Itoa(sc.UID()) {
+			continue
+		}
+		if gid, ok := im.Labels["skeg.io/image/gid"]; ok && gid != strconv.Itoa(sc.GID()) {
+			continue
+		}
+		filtered = append(filtered, im)
+	}
+
+	return filtered
+}
+
 func RemoveUserImage(dc DockerClient, im UserImage) error {
 	return dc.RemoveImage(im.Name)
 }
 
-func BaseImages(dc DockerClient) ([]*BaseImage, error) {
+func BaseImages(dc DockerClient, sc SystemClient) ([]*BaseImage, error) {
 
 	images := make([]*BaseImage, 0)
 
+	imageCatalog, err := sc.ImageCatalog()
+	if err != nil {
+		return images, err
+	}
+
 	dockerImages, err := dc.ListImages()
 	if err != nil {
 		return images, err
@@ -666,48 +1452,21 @@ func BaseImages(dc DockerClient) ([]*BaseImage, error) {
 		}
 	}
 
-	// TODO: get this information from somewhere else.  API?
-	var baseImages = []*BaseImage{
-		{
-			"go",
-			"Golang Image",
-			[]*BaseImageTag{
-				{"1.4", false, false},
-				{"1.5", false, false},
-				{"1.6", false, false},
-				{"1.7", false, true},
-				{"1.8", false, false},
-			},
-		},
-		{
-			"clojure",
-			"Clojure image",
-			[]*BaseImageTag{
-				{"java7", false, false},
-				{"java8", false, true},
-			},
-		},
-		{
-			"python",
-			"Python base image",
-			[]*BaseImageTag{
-				{"both", false, true},
-				{"2.7", false, false},
-				{"3.5", false, false},
-			},
-		},
-	}
-
-	for _, bimage := range baseImages {
-		for _, btag := range bimage.Tags {
-			imageTag := fmt.Sprintf("%s/%s:%s", DOCKER_HUB_ORG, bimage.Name, btag.Name)
+	// copy the catalog so pulled status doesn't leak between calls
+	for _, cimage := range imageCatalog {
+		bimage := &BaseImage{cimage.Name, cimage.Description, cimage.Org, make([]*BaseImageTag, 0)}
+		for _, ctag := range cimage.Tags {
+			btag := &BaseImageTag{ctag.Name, false, ctag.Preferred}
+			imageTag := fmt.Sprintf("%s/%s:%s", bimage.Org, bimage.Name, btag.Name)
 			if _, ok := tagToImage[imageTag]; ok {
 				btag.Pulled = true
 			}
+			bimage.Tags = append(bimage.Tags, btag)
 		}
+		images = append(images, bimage)
 	}
 
-	return baseImages, nil
+	return images, nil
 }
 
 func GetEnvironment(dc DockerClient, sc SystemClient, name string) (Environment, error) {
@@ -736,33 +1495,234 @@ func ConnectEnvironment(dc DockerClient, sc SystemClient, name string, extra []s
 		return errors.New("No container found")
 	}
 
-	host, port, err := containerSshHostPort(env)
+	if sc.UseNativeSSH() {
+		return connectNative(sc, env, extra)
+	}
+
+	opts, err := sshOptions(sc, env)
 	if err != nil {
 		return err
 	}
 
-	key, err := sc.EnsureSSHKey()
+	return sc.RunSSH(
+		"ssh", append(opts, extra...),
+	)
+}
+
+// ExitError is returned when a command run in an environment exits with a
+// non-zero status.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// connectNative connects with the built in ssh client.  Of the ssh options
+// in extra only -A and -t are supported, the rest is the command to run.
+func connectNative(sc SystemClient, env Environment, extra []string) error {
+	opts, err := sshConnectOpts(sc, env)
 	if err != nil {
 		return err
 	}
 
-	err = sc.CheckSSHPort(host, port)
+	for _, arg := range extra {
+		switch {
+		case len(opts.Command) > 0:
+			opts.Command = append(opts.Command, arg)
+		case arg == "-A":
+			opts.ForwardAgent = true
+		case arg == "-t" || arg == "-tt":
+			opts.Tty = true
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("ssh option %s isn't supported by the native ssh client", arg)
+		default:
+			opts.Command = append(opts.Command, arg)
+		}
+	}
+
+	code, err := sc.RunNativeSSH(opts)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return &ExitError{code}
+	}
+
+	return nil
+}
+
+// installHostKey copies the environment's ssh host key into its container,
+// and pins it in the known_hosts file under the container name.  The key is
+// kept across rebuilds.
+func installHostKey(dc DockerClient, sc SystemClient, envName, containerName string) error {
+	key, err := sc.EnsureHostKey(envName)
+	if err != nil {
+		return err
+	}
+
+	privateKey, err := ioutil.ReadFile(key.privatePath)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := ioutil.ReadFile(key.publicPath)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := []struct {
+		name string
+		mode int64
+		data []byte
+	}{
+		{"ssh_host_ed25519_key", 0600, privateKey},
+		{"ssh_host_ed25519_key.pub", 0644, publicKey},
+	}
+	for _, file := range files {
+		err = tw.WriteHeader(&tar.Header{Name: file.name, Mode: file.mode, Size: int64(len(file.data)), Typeflag: tar.TypeReg})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(file.data)
+		if err != nil {
+			return err
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+
+	err = dc.UploadToContainer(containerName, "/etc/ssh", &buf)
 	if err != nil {
 		return err
 	}
 
+	return sc.SetKnownHost(containerName, string(publicKey))
+}
+
+// removeHostKey removes an environment's ssh host key and its known_hosts
+// entry.
+func removeHostKey(sc SystemClient, envName string) error {
+	err := sc.RemoveHostKey(envName)
+	if err != nil {
+		return err
+	}
+
+	return sc.SetKnownHost(fmt.Sprintf("%s_%s_%s", CONT_PREFIX, sc.Username(), envName), "")
+}
+
+// sshConnectOpts returns what's needed to connect to a running environment
+// with ssh, once its ssh port is accepting connections.
+func sshConnectOpts(sc SystemClient, env Environment) (SSHConnectOpts, error) {
+	host, port, err := containerSshHostPort(env)
+	if err != nil {
+		return SSHConnectOpts{}, err
+	}
+
+	key, err := sc.EnsureSSHKey()
+	if err != nil {
+		return SSHConnectOpts{}, err
+	}
+
+	err = sc.CheckSSHPort(host, port)
+	if err != nil {
+		return SSHConnectOpts{}, err
+	}
+
+	opts := SSHConnectOpts{
+		Host: host,
+		Port: port,
+		User: sc.Username(),
+		Key:  key,
+	}
+
+	// environments created before host keys were pinned have a random one
+	if env.Container.Labels["skeg.io/container/host_key"] == "true" {
+		opts.KnownHosts = sc.KnownHostsPath()
+		opts.HostKeyAlias = env.Container.Name
+	} else {
+		logrus.Warnf("Environment %s has no pinned host key, rebuild it to add one", env.Name)
+	}
+
+	return opts, nil
+}
+
+// sshOptions returns the ssh command line options needed to connect to a
+// running environment.
+func sshOptions(sc SystemClient, env Environment) ([]string, error) {
+	co, err := sshConnectOpts(sc, env)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := []string{
-		host,
-		"-l", sc.Username(),
-		"-p", fmt.Sprintf("%d", port),
-		"-i", key.privatePath,
+		co.Host,
+		"-l", co.User,
+		"-p", fmt.Sprintf("%d", co.Port),
+	}
+
+	// with an agent, ssh picks the key from the agent's identities
+	if !co.Key.agent {
+		opts = append(opts, "-i", co.Key.privatePath)
+	}
+
+	if len(co.HostKeyAlias) > 0 {
+		return append(opts,
+			"-o", fmt.Sprintf("UserKnownHostsFile %s", co.KnownHosts),
+			"-o", "StrictHostKeyChecking yes",
+			"-o", fmt.Sprintf("HostKeyAlias %s", co.HostKeyAlias),
+		), nil
+	}
+
+	return append(opts,
 		"-o", "UserKnownHostsFile /dev/null",
 		"-o", "StrictHostKeyChecking no",
+	), nil
+}
+
+// ExecEnvironment runs a command in an environment as the user with the Docker
+// exec API, from workdir or the home directory.  It returns the command's exit
+// code.
+func ExecEnvironment(dc DockerClient, sc SystemClient, name, workdir string, eo ExecOpts) (int, error) {
+	if len(eo.Cmd) == 0 {
+		return 0, errors.New("No command given")
 	}
 
-	return sc.RunSSH(
-		"ssh", append(opts, extra...),
-	)
+	env, err := EnsureRunning(dc, sc, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if env.Container == nil {
+		return 0, errors.New("No container found")
+	}
+
+	if len(workdir) == 0 {
+		workdir = fmt.Sprintf("/home/%s", sc.Username())
+	}
+
+	// the exec API doesn't support a working directory, so change to it in a
+	// shell before running the command
+	eo.Cmd = append([]string{"sh", "-c", `cd "$1" && shift && exec "$@"`, "sh", workdir}, eo.Cmd...)
+	eo.User = sc.Username()
+
+	logrus.Debugf("Creating exec in %s: %v", env.Container.Name, eo.Cmd)
+	id, err := dc.CreateExec(env.Container.Name, eo)
+	if err != nil {
+		return 0, err
+	}
+
+	err = dc.StartExec(id, eo)
+	if err != nil {
+		return 0, err
+	}
+
+	return dc.InspectExec(id)
 }
 
 func SshConfigEnvironment(dc DockerClient, sc SystemClient, name string) (string, error) {
@@ -776,12 +1736,84 @@ func SshConfigEnvironment(dc DockerClient, sc SystemClient, name string) (string
 		return "", errors.New("No container found")
 	}
 
-	host, port, err := containerSshHostPort(env)
+	key, err := sc.EnsureSSHKey()
 	if err != nil {
 		return "", err
 	}
 
+	return sshConfigEntry(sc, env, env.Name, key)
+}
+
+// InstallSSHConfig writes the ssh config managed by skeg and includes it from
+// the user's ssh config, so environments can be reached as skeg-<name>.
+func InstallSSHConfig(dc DockerClient, sc SystemClient) error {
+	err := sc.InstallSSHConfig()
+	if err != nil {
+		return err
+	}
+
+	return UpdateSSHConfig(dc, sc)
+}
+
+// UpdateSSHConfig regenerates the managed ssh config, if it's installed, with
+// a Host entry for every running environment.  Host ports change whenever an
+// environment is started, so it's updated on start, stop and destroy.
+func UpdateSSHConfig(dc DockerClient, sc SystemClient) error {
+	if !sc.SSHConfigInstalled() {
+		return nil
+	}
+
+	envs, err := Environments(dc, sc)
+	if err != nil {
+		return err
+	}
+
 	key, err := sc.EnsureSSHKey()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(envs))
+	for name := range envs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var config bytes.Buffer
+	config.WriteString("# Managed by skeg, changes will be overwritten.\n\n")
+
+	for _, name := range names {
+		env := envs[name]
+		if env.Container == nil || !env.Container.Running {
+			fmt.Fprintf(&config, "# %s%s isn't running\n\n", SSH_HOST_PREFIX, name)
+			continue
+		}
+
+		entry, err := sshConfigEntry(sc, env, SSH_HOST_PREFIX+name, key)
+		if err != nil {
+			fmt.Fprintf(&config, "# %s%s: %s\n\n", SSH_HOST_PREFIX, name, err)
+			continue
+		}
+		config.WriteString(entry)
+	}
+
+	logrus.Debugf("Updating managed ssh config")
+	return sc.WriteSSHConfig(config.String())
+}
+
+// refreshSSHConfig updates the managed ssh config after an environment
+// changes, without failing the change.
+func refreshSSHConfig(dc DockerClient, sc SystemClient) {
+	err := UpdateSSHConfig(dc, sc)
+	if err != nil {
+		logrus.Warnf("Unable to update ssh config: %s", err)
+	}
+}
+
+// sshConfigEntry returns the ssh config Host entry, named hostName, for a
+// running environment.
+func sshConfigEntry(sc SystemClient, env Environment, hostName string, key SSHKey) (string, error) {
+	host, port, err := containerSshHostPort(env)
 	if err != nil {
 		return "", err
 	}
@@ -790,19 +1822,33 @@ func SshConfigEnvironment(dc DockerClient, sc SystemClient, name string) (string
   HostName {{ .Host }}
   User {{ .Username }}
   Port {{ .Port }}
+{{- if .KnownHosts }}
+  UserKnownHostsFile {{ .KnownHosts }}
+  StrictHostKeyChecking yes
+  HostKeyAlias {{ .Alias }}
+{{- else }}
   UserKnownHostsFile /dev/null
   StrictHostKeyChecking no
+{{- end }}
   PasswordAuthentication no
+{{- if .KeyPath }}
   IdentityFile {{ .KeyPath }}
   IdentitiesOnly yes
+{{- end }}
   LogLevel FATAL
 
 `
 	sshConfigData := struct {
-		Name, Host, Username, KeyPath string
-		Port                          int64
+		Name, Host, Username, KeyPath, KnownHosts, Alias string
+		Port                                             int64
 	}{
-		env.Name, host, sc.Username(), key.privatePath, port,
+		hostName, host, sc.Username(), "", "", env.Container.Name, port,
+	}
+	if !key.agent {
+		sshConfigData.KeyPath = key.privatePath
+	}
+	if env.Container.Labels["skeg.io/container/host_key"] == "true" {
+		sshConfigData.KnownHosts = sc.KnownHostsPath()
 	}
 
 	tmpl := template.Must(template.New("ssh-config").Parse(sshConfig))
@@ -855,8 +1901,23 @@ func Environments(dc DockerClient, sc SystemClient) (map[string]Environment, err
 	}
 
 	containersByName := make(map[string]*Container)
+	servicesByEnv := make(map[string][]Service)
 	for _, cont := range dockerContainers {
 		name := strings.TrimPrefix(cont.Names[0], "/")
+
+		if envName, ok := cont.Labels["skeg.io/service/env"]; ok {
+			if cont.Labels["skeg.io/service/user"] == sc.Username() {
+				servicesByEnv[envName] = append(servicesByEnv[envName], Service{
+					Name:      cont.Labels["skeg.io/service/name"],
+					Container: name,
+					Image:     cont.Image,
+					Running:   strings.Contains(cont.Status, "Up"),
+					Status:    cont.Status,
+				})
+			}
+			continue
+		}
+
 		ports := make([]Port, 0)
 		for _, cPort := range cont.Ports {
 			ports = append(ports, Port{
@@ -896,6 +1957,7 @@ func Environments(dc DockerClient, sc SystemClient) (map[string]Environment, err
 		newEnv := Environment{
 			Name:      file,
 			Container: containersByName[contName],
+			Services:  servicesByEnv[file],
 		}
 
 		if cont, ok := containersByName[contName]; ok {
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/fsouza/go-dockerclient"
@@ -42,6 +46,15 @@ func NewFailures() *Failures {
 type TestDockerClient struct {
 	containers []docker.APIContainers
 	images     []docker.APIImages
+	files      map[string]string
+	links      map[string]string
+	execs      []ExecOpts
+	exitCode   int
+	created    []CreateContainerOpts
+	networks   []docker.Network
+	volumes    []docker.Volume
+	imageVols  map[string][]string
+	mounts     []docker.Mount
 	fails      *Failures
 }
 
@@ -86,11 +99,20 @@ func (rdc *TestDockerClient) BuildImage(name string, dockerfile string, key stri
 }
 
 func (rdc *TestDockerClient) CreateContainer(cco CreateContainerOpts) error {
+	rdc.created = append(rdc.created, cco)
 	return nil
 }
 
 func (rdc *TestDockerClient) InspectContainer(cont string) (*docker.Container, error) {
-	return nil, nil
+	return &docker.Container{Mounts: rdc.mounts}, nil
+}
+
+func (rdc *TestDockerClient) InspectImage(name string) (*docker.Image, error) {
+	volumes := make(map[string]struct{})
+	for _, path := range rdc.imageVols[name] {
+		volumes[path] = struct{}{}
+	}
+	return &docker.Image{ID: name, Config: &docker.Config{Volumes: volumes}}, nil
 }
 
 func (rdc *TestDockerClient) StartContainer(name string) error {
@@ -110,6 +132,14 @@ func (rdc *TestDockerClient) StartContainer(name string) error {
 }
 
 func (rdc *TestDockerClient) RemoveContainer(name string) error {
+	var newContainers []docker.APIContainers
+	for _, cont := range rdc.containers {
+		if cont.Names[0] != fmt.Sprintf("/%s", name) {
+			newContainers = append(newContainers, cont)
+		}
+	}
+	rdc.containers = newContainers
+
 	return nil
 }
 
@@ -140,21 +170,157 @@ func (rdc *TestDockerClient) AddImage(image docker.APIImages) error {
 }
 
 func (rdc *TestDockerClient) ListVolumes() ([]docker.Volume, error) {
-	return []docker.Volume{}, nil
+	return rdc.volumes, nil
 }
 
 func (rdc *TestDockerClient) CreateVolume(cvo CreateVolumeOpts) error {
+	rdc.volumes = append(rdc.volumes, docker.Volume{Name: cvo.Name, Labels: cvo.Labels})
 	return nil
 }
 
 func (rdc *TestDockerClient) RemoveVolume(name string) error {
+	var volumes []docker.Volume
+	for _, vol := range rdc.volumes {
+		if vol.Name != name {
+			volumes = append(volumes, vol)
+		}
+	}
+	rdc.volumes = volumes
+	return nil
+}
+
+func (rdc *TestDockerClient) RemoveImage(name string) error {
+	var images []docker.APIImages
+	for _, im := range rdc.images {
+		if im.ID != name && (len(im.RepoTags) == 0 || im.RepoTags[0] != name) {
+			images = append(images, im)
+		}
+	}
+	rdc.images = images
+	return nil
+}
+
+func (rdc *TestDockerClient) CreateExec(name string, eo ExecOpts) (string, error) {
+	if err, ok := rdc.fails.failures["CreateExec"]; ok {
+		return "", err
+	}
+	rdc.execs = append(rdc.execs, eo)
+	return fmt.Sprintf("exec%d", len(rdc.execs)), nil
+}
+
+func (rdc *TestDockerClient) StartExec(id string, eo ExecOpts) error {
+	if err, ok := rdc.fails.failures["StartExec"]; ok {
+		return err
+	}
+	if eo.Stdout != nil {
+		fmt.Fprintf(eo.Stdout, "ran %s", id)
+	}
+	return nil
+}
+
+func (rdc *TestDockerClient) InspectExec(id string) (int, error) {
+	return rdc.exitCode, nil
+}
+
+func (rdc *TestDockerClient) CommitContainer(name, repo, tag string, labels map[string]string) error {
+	if err, ok := rdc.fails.failures["CommitContainer"]; ok {
+		return err
+	}
+	rdc.images = append(rdc.images, docker.APIImages{
+		RepoTags: []string{fmt.Sprintf("%s:%s", repo, tag)},
+		Created:  int64(len(rdc.images)),
+		Labels:   labels,
+	})
+	return nil
+}
+
+func (rdc *TestDockerClient) ListNetworks() ([]docker.Network, error) {
+	return rdc.networks, nil
+}
+
+func (rdc *TestDockerClient) CreateNetwork(cno CreateNetworkOpts) error {
+	rdc.networks = append(rdc.networks, docker.Network{Name: cno.Name, Labels: cno.Labels})
+	return nil
+}
+
+func (rdc *TestDockerClient) RemoveNetwork(name string) error {
+	networks := make([]docker.Network, 0)
+	for _, network := range rdc.networks {
+		if network.Name != name {
+			networks = append(networks, network)
+		}
+	}
+	rdc.networks = networks
+	return nil
+}
+
+func (rdc *TestDockerClient) DownloadFromContainer(name, path string, output io.Writer) error {
+	if err, ok := rdc.fails.failures["DownloadFromContainer"]; ok {
+		return err
+	}
+	tw := tar.NewWriter(output)
+	if link, ok := rdc.links[path]; ok {
+		tw.WriteHeader(&tar.Header{Name: filepath.Base(path), Typeflag: tar.TypeSymlink, Linkname: link})
+	} else if contents, ok := rdc.files[path]; ok {
+		tw.WriteHeader(&tar.Header{Name: filepath.Base(path), Mode: 0644, Size: int64(len(contents))})
+		tw.Write([]byte(contents))
+	} else {
+		return fmt.Errorf("Could not find the file %s in container %s", path, name)
+	}
+	return tw.Close()
+}
+
+func (rdc *TestDockerClient) UploadToContainer(name, path string, input io.Reader) error {
+	tr := tar.NewReader(input)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		data, _ := ioutil.ReadAll(tr)
+		rdc.files[filepath.Join(path, header.Name)] = string(data)
+	}
+}
+
+func (rdc *TestDockerClient) ExportImage(name string, output io.Writer) error {
+	_, err := output.Write([]byte(name))
+	return err
+}
+
+func (rdc *TestDockerClient) LoadImage(input io.Reader) error {
+	data, _ := ioutil.ReadAll(input)
+	rdc.images = append(rdc.images, docker.APIImages{RepoTags: []string{string(data)}})
+	return nil
+}
+
+func (rdc *TestDockerClient) ServerVersion() (string, string, error) {
+	if err, ok := rdc.fails.failures["ServerVersion"]; ok {
+		return "", "", err
+	}
+	return "17.06.0-ce", "1.30", nil
+}
+
+func (rdc *TestDockerClient) ConnectNetwork(network, container string, aliases []string) error {
 	return nil
 }
 
 type TestSystemClient struct {
-	environments []string
-	sshArgs      [][]string
-	fails        *Failures
+	environments       []string
+	sshArgs            [][]string
+	forwards           []Forward
+	stopped            []int
+	agent              bool
+	native             bool
+	nativeOpts         []SSHConnectOpts
+	exitCode           int
+	sshConfig          string
+	sshConfigInstalled bool
+	emptyDirs          []string
+	missingCommands    []string
+	catalog            []*BaseImage
+	fails              *Failures
 }
 
 func (rsc *TestSystemClient) DetectTimeZone() string {
@@ -188,19 +354,129 @@ func (tsc *TestSystemClient) EnsureEnvironmentDir(envName string) (string, error
 	return envName, nil
 }
 
+func (tsc *TestSystemClient) RenameEnvironmentDir(oldName, newName string) error {
+	return nil
+}
+
 func (tsc *TestSystemClient) RemoveEnvironmentDir(envName string) error {
+	environments := make([]string, 0)
+	for _, env := range tsc.environments {
+		if env != envName {
+			environments = append(environments, env)
+		}
+	}
+	tsc.environments = environments
 	return nil
 }
 
+func (tsc *TestSystemClient) EnvironmentDirEmpty(envName string) (bool, error) {
+	for _, dir := range tsc.emptyDirs {
+		if dir == envName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (tsc *TestSystemClient) EnsureSSHKey() (SSHKey, error) {
+	return SSHKey{agent: tsc.agent}, nil
+}
+
+func (tsc *TestSystemClient) CheckSSHKey() (string, error) {
+	if err, ok := tsc.fails.failures["CheckSSHKey"]; ok {
+		return "skeg_key", err
+	}
+	return "skeg_key", nil
+}
+
+func (tsc *TestSystemClient) CommandAvailable(name string) bool {
+	for _, missing := range tsc.missingCommands {
+		if missing == name {
+			return false
+		}
+	}
+	return true
+}
+
+func (tsc *TestSystemClient) EnsureHostKey(envName string) (SSHKey, error) {
 	return SSHKey{}, nil
 }
 
+func (tsc *TestSystemClient) RemoveHostKey(envName string) error {
+	return nil
+}
+
+func (tsc *TestSystemClient) KnownHostsPath() string {
+	return "/home/nate/skegs/known_hosts"
+}
+
+func (tsc *TestSystemClient) SetKnownHost(alias, publicKey string) error {
+	return nil
+}
+
 func (tsc *TestSystemClient) RunSSH(command string, args []string) error {
 	tsc.sshArgs = append(tsc.sshArgs, args)
 	return nil
 }
 
+func (tsc *TestSystemClient) InstallSSHConfig() error {
+	tsc.sshConfigInstalled = true
+	return nil
+}
+
+func (tsc *TestSystemClient) SSHConfigInstalled() bool {
+	return tsc.sshConfigInstalled
+}
+
+func (tsc *TestSystemClient) WriteSSHConfig(config string) error {
+	tsc.sshConfig = config
+	return nil
+}
+
+func (tsc *TestSystemClient) UseNativeSSH() bool {
+	return tsc.native
+}
+
+func (tsc *TestSystemClient) RunNativeSSH(opts SSHConnectOpts) (int, error) {
+	tsc.nativeOpts = append(tsc.nativeOpts, opts)
+	return tsc.exitCode, nil
+}
+
+func (tsc *TestSystemClient) StartSSH(command string, args []string) (int, error) {
+	if err, ok := tsc.fails.failures["StartSSH"]; ok {
+		return 0, err
+	}
+	tsc.sshArgs = append(tsc.sshArgs, args)
+	return 1000 + len(tsc.sshArgs), nil
+}
+
+func (tsc *TestSystemClient) ForwardRunning(forward Forward) bool {
+	for _, stopped := range tsc.stopped {
+		if stopped == forward.Pid {
+			return false
+		}
+	}
+	return true
+}
+
+func (tsc *TestSystemClient) StopProcess(pid int) error {
+	tsc.stopped = append(tsc.stopped, pid)
+	return nil
+}
+
+func (tsc *TestSystemClient) Forwards() ([]Forward, error) {
+	return append([]Forward{}, tsc.forwards...), nil
+}
+
+func (tsc *TestSystemClient) SaveForwards(forwards []Forward) error {
+	tsc.forwards = forwards
+	return nil
+}
+
+func (tsc *TestSystemClient) DockerSocketGID(path string) (int, error) {
+	return 999, nil
+}
+
 func (tsc *TestSystemClient) CheckSSHPort(host string, port int64) error {
 	if err, ok := tsc.fails.failures["CheckSSHPort"]; ok {
 		return err
@@ -208,9 +484,19 @@ func (tsc *TestSystemClient) CheckSSHPort(host string, port int64) error {
 	return nil
 }
 
+func (tsc *TestSystemClient) ImageCatalog() ([]*BaseImage, error) {
+	if tsc.catalog == nil {
+		return mustParseCatalog(defaultCatalog), nil
+	}
+	return tsc.catalog, nil
+}
+
 func NewTestDockerClient() *TestDockerClient {
 	return &TestDockerClient{
-		fails: NewFailures(),
+		files:     make(map[string]string),
+		links:     make(map[string]string),
+		imageVols: make(map[string][]string),
+		fails:     NewFailures(),
 	}
 }
 
@@ -233,7 +519,7 @@ func TestEnvironments(t *testing.T) {
 			Image:  "skeg-nate-1234",
 			Status: "Up 12 hours",
 			Ports: []docker.APIPort{
-				{32768, 22, "tcp", "0.0.0.0"},
+				{PrivatePort: 32768, PublicPort: 22, Type: "tcp", IP: "0.0.0.0"},
 			},
 			Labels: map[string]string{
 				"skeg.io/image/base": "clojure",
@@ -259,8 +545,10 @@ func TestEnvironments(t *testing.T) {
 					map[string]string{
 						"skeg.io/image/base": "clojure",
 					},
+					[]map[string]string{},
 				},
 				"clojure",
+				nil,
 			},
 		},
 		envs,
@@ -298,7 +586,7 @@ func TestBaseImages(t *testing.T) {
 		},
 	)
 
-	baseImages, err := BaseImages(dc)
+	baseImages, err := BaseImages(dc, NewTestSystemClient())
 	assert.Nil(err)
 
 	assert.Equal(
@@ -307,6 +595,7 @@ func TestBaseImages(t *testing.T) {
 			{
 				"go",
 				"Golang Image",
+				"skegio",
 				[]*BaseImageTag{
 					{"1.4", false, false},
 					{"1.5", false, false},
@@ -318,6 +607,7 @@ func TestBaseImages(t *testing.T) {
 			{
 				"clojure",
 				"Clojure image",
+				"skegio",
 				[]*BaseImageTag{
 					{"java7", false, false},
 					{"java8", false, true},
@@ -326,6 +616,7 @@ func TestBaseImages(t *testing.T) {
 			{
 				"python",
 				"Python base image",
+				"skegio",
 				[]*BaseImageTag{
 					{"both", false, true},
 					{"2.7", false, false},
@@ -377,7 +668,13 @@ func TestParsePorts(t *testing.T) {
 		{[]string{"1194/udp"}, []Port{{"", 0, 1194, "udp"}}, nil},
 		{[]string{"80:80"}, []Port{{"", 80, 80, "tcp"}}, nil},
 		{[]string{"2222:22"}, []Port{}, errors.New("bad container port, 22 reserved for ssh")},
-		{[]string{"7000-7005:7000"}, []Port{}, errors.New("dynamic port ranges not supported (yet)")},
+		{[]string{"7000-7005:7000"}, []Port{}, errors.New("Host port range 7000-7005 for the single container port 7000 isn't supported, give one host port or a container range of the same length")},
+		{[]string{"8000-8010:80"}, []Port{}, errors.New("Host port range 8000-8010 for the single container port 80 isn't supported, give one host port or a container range of the same length")},
+		{[]string{"8000-8002:9000-9005"}, []Port{}, errors.New("Invalid ranges specified for container and host Ports: 9000-9005 and 8000-8002")},
+		{[]string{"8000-8002:8000-8002"}, []Port{{"", 8000, 8000, "tcp"}, {"", 8001, 8001, "tcp"}, {"", 8002, 8002, "tcp"}}, nil},
+		{[]string{"127.0.0.1:9000-9001:9000-9001/udp"}, []Port{{"127.0.0.1", 9000, 9000, "udp"}, {"127.0.0.1", 9001, 9001, "udp"}}, nil},
+		{[]string{"6000-6001"}, []Port{{"", 0, 6000, "tcp"}, {"", 0, 6001, "tcp"}}, nil},
+		{[]string{"20-22:20-22"}, []Port{}, errors.New("bad container port, 22 reserved for ssh")},
 		{[]string{"fred"}, []Port{}, errors.New("Invalid containerPort: fred")},
 	}
 
@@ -388,13 +685,40 @@ func TestParsePorts(t *testing.T) {
 	}
 }
 
+func TestCompactPorts(t *testing.T) {
+	assert := assert.New(t)
+
+	ports := []Port{
+		{"0.0.0.0", 8002, 8002, "tcp"},
+		{"0.0.0.0", 8000, 8000, "tcp"},
+		{"0.0.0.0", 8001, 8001, "tcp"},
+		{"0.0.0.0", 32768, 22, "tcp"},
+		{"127.0.0.1", 9000, 9000, "udp"},
+		{"127.0.0.1", 9001, 9001, "udp"},
+		{"0.0.0.0", 4000, 3000, "tcp"},
+		{"0.0.0.0", 4002, 3001, "tcp"},
+		{"", 0, 6000, "tcp"},
+		{"", 0, 6001, "tcp"},
+	}
+
+	assert.Equal([]string{
+		"6000-6001/tcp",
+		"32768->22/tcp",
+		"4000->3000/tcp",
+		"4002->3001/tcp",
+		"8000-8002->8000-8002/tcp",
+		"127.0.0.1:9000-9001->9000-9001/udp",
+	}, CompactPorts(ports))
+	assert.Equal([]string{}, CompactPorts([]Port{}))
+}
+
 func TestEnsureStopped(t *testing.T) {
 	assert := assert.New(t)
 
 	tempdir, _ := ioutil.TempDir("", "ddc")
 	defer os.RemoveAll(tempdir)
 
-	sc, _ := NewSystemClientWithBase(tempdir)
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
 
 	dc := NewTestDockerClient()
 	dc.AddContainer(
@@ -404,7 +728,7 @@ func TestEnsureStopped(t *testing.T) {
 			Image:  "skeg-nate-1234",
 			Status: "Up 12 hours",
 			Ports: []docker.APIPort{
-				{32768, 22, "tcp", "0.0.0.0"},
+				{PrivatePort: 32768, PublicPort: 22, Type: "tcp", IP: "0.0.0.0"},
 			},
 			Labels: map[string]string{
 				"skeg.io/image/base": "clojure",
@@ -441,7 +765,7 @@ func TestEnsureRunning(t *testing.T) {
 	tempdir, _ := ioutil.TempDir("", "ddc")
 	defer os.RemoveAll(tempdir)
 
-	sc, _ := NewSystemClientWithBase(tempdir)
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
 
 	dc := NewTestDockerClient()
 	dc.AddContainer(
@@ -451,7 +775,7 @@ func TestEnsureRunning(t *testing.T) {
 			Image:  "skeg-nate-1234",
 			Status: "Exited (0) 1 hour ago",
 			Ports: []docker.APIPort{
-				{22, 32768, "tcp", "0.0.0.0"},
+				{PrivatePort: 22, PublicPort: 32768, Type: "tcp", IP: "0.0.0.0"},
 			},
 			Labels: map[string]string{
 				"skeg.io/image/base": "clojure",
@@ -495,10 +819,11 @@ func TestConnectEnvironment(t *testing.T) {
 			Image:  "skeg-nate-1234",
 			Status: "Exited (0) 1 hour ago",
 			Ports: []docker.APIPort{
-				{22, 32768, "tcp", "0.0.0.0"},
+				{PrivatePort: 22, PublicPort: 32768, Type: "tcp", IP: "0.0.0.0"},
 			},
 			Labels: map[string]string{
-				"skeg.io/image/base": "clojure",
+				"skeg.io/image/base":         "clojure",
+				"skeg.io/container/host_key": "true",
 			},
 		},
 	)
@@ -523,7 +848,7 @@ func TestConnectEnvironment(t *testing.T) {
 			Image:  "skeg-nate-1234",
 			Status: "Exited (0) 1 hour ago",
 			Ports: []docker.APIPort{
-				{22, 32768, "tcp", "192.168.0.100"},
+				{PrivatePort: 22, PublicPort: 32768, Type: "tcp", IP: "192.168.0.100"},
 			},
 			Labels: map[string]string{
 				"skeg.io/image/base": "clojure",
@@ -541,7 +866,7 @@ func TestConnectEnvironment(t *testing.T) {
 	env, err = GetEnvironment(dc, sc, "foo")
 	assert.Nil(err)
 	assert.True(env.Container.Running)
-	assert.Equal([]string{"localhost", "-l", "nate", "-p", "32768", "-i", "", "-o", "UserKnownHostsFile /dev/null", "-o", "StrictHostKeyChecking no"}, sc.sshArgs[len(sc.sshArgs)-1])
+	assert.Equal([]string{"localhost", "-l", "nate", "-p", "32768", "-i", "", "-o", "UserKnownHostsFile /home/nate/skegs/known_hosts", "-o", "StrictHostKeyChecking yes", "-o", "HostKeyAlias skeg_nate_foo"}, sc.sshArgs[len(sc.sshArgs)-1])
 
 	err = ConnectEnvironment(dc, sc, "bar", []string{})
 	assert.Equal(err, errors.New("Environment bar doesn't exist."))
@@ -552,8 +877,10 @@ func TestConnectEnvironment(t *testing.T) {
 	err = ConnectEnvironment(dc, sc, "qux", []string{})
 	assert.Equal(err, errors.New("Running container doesn't have ssh running"))
 
+	// environments without a pinned host key don't check it
 	err = ConnectEnvironment(dc, sc, "buz", []string{})
 	assert.Equal("192.168.0.100", sc.sshArgs[len(sc.sshArgs)-1][0])
+	assert.Equal([]string{"-o", "UserKnownHostsFile /dev/null", "-o", "StrictHostKeyChecking no"}, sc.sshArgs[len(sc.sshArgs)-1][7:])
 	assert.Nil(err)
 
 	os.Setenv("DOCKER_HOST", "tcp://192.168.0.101:2376")
@@ -565,6 +892,71 @@ func TestConnectEnvironment(t *testing.T) {
 	args := sc.sshArgs[len(sc.sshArgs)-1]
 	assert.Equal("-A", args[len(args)-1])
 	assert.Nil(err)
+
+	// keys from the agent aren't passed with -i
+	sc.agent = true
+	err = ConnectEnvironment(dc, sc, "buz", []string{})
+	assert.NotContains(sc.sshArgs[len(sc.sshArgs)-1], "-i")
+	assert.Nil(err)
+	sc.agent = false
+
+	// the native client gets the same options, parsed from ssh's
+	os.Unsetenv("DOCKER_HOST")
+	sc.native = true
+	nArgs := len(sc.sshArgs)
+	err = ConnectEnvironment(dc, sc, "foo", []string{"-A", "-t", "ls", "-la"})
+	assert.Nil(err)
+	assert.Equal(nArgs, len(sc.sshArgs))
+	opts := sc.nativeOpts[len(sc.nativeOpts)-1]
+	assert.Equal("localhost", opts.Host)
+	assert.Equal(int64(32768), opts.Port)
+	assert.Equal("nate", opts.User)
+	assert.Equal("/home/nate/skegs/known_hosts", opts.KnownHosts)
+	assert.Equal("skeg_nate_foo", opts.HostKeyAlias)
+	assert.Equal([]string{"ls", "-la"}, opts.Command)
+	assert.True(opts.ForwardAgent)
+	assert.True(opts.Tty)
+
+	err = ConnectEnvironment(dc, sc, "buz", []string{})
+	assert.Nil(err)
+	assert.Equal("", sc.nativeOpts[len(sc.nativeOpts)-1].HostKeyAlias)
+
+	err = ConnectEnvironment(dc, sc, "foo", []string{"-L", "80:localhost:80"})
+	assert.Equal(errors.New("ssh option -L isn't supported by the native ssh client"), err)
+
+	sc.exitCode = 2
+	err = ConnectEnvironment(dc, sc, "foo", []string{"false"})
+	assert.Equal(&ExitError{2}, err)
+}
+
+func TestMountVolume(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	gitconfig := filepath.Join(tempdir, ".gitconfig")
+	ioutil.WriteFile(gitconfig, []byte("[user]\n"), 0644)
+
+	var mountTests = []struct {
+		mount  MountOpts
+		volume string
+		isFile bool
+		err    error
+	}{
+		{MountOpts{gitconfig, "", ""}, gitconfig + ":/home/nate/.gitconfig:ro", true, nil},
+		{MountOpts{tempdir, "secrets", "rw"}, tempdir + ":/home/nate/secrets:rw", false, nil},
+		{MountOpts{tempdir, "/.config/secrets", "ro"}, tempdir + ":/home/nate/.config/secrets:ro", false, nil},
+		{MountOpts{filepath.Join(tempdir, "missing"), "", ""}, "", false, nil},
+		{MountOpts{tempdir, "", "rx"}, "", false, errors.New("Bad mode 'rx' for mount " + tempdir + ", must be ro or rw")},
+	}
+
+	for _, test := range mountTests {
+		volume, isFile, err := mountVolume("/home/nate", test.mount)
+		assert.Equal(test.volume, volume)
+		assert.Equal(test.isFile, isFile)
+		assert.Equal(test.err, err)
+	}
 }
 
 // TODO: re-enable when TestDockerClient is a little smarter
@@ -574,7 +966,7 @@ func TestConnectEnvironment(t *testing.T) {
 // 	tempdir, _ := ioutil.TempDir("", "ddc")
 // 	defer os.RemoveAll(tempdir)
 
-// 	sc, _ := NewSystemClientWithBase(tempdir)
+// 	sc, _ := NewSystemClientWithBase(tempdir, Config{})
 
 // 	dc, _ := NewTestDockerClient()
 
@@ -611,3 +1003,339 @@ func TestConnectEnvironment(t *testing.T) {
 // 	assert.Equal(err, liError)
 
 // }
+
+func TestFilterImagesForUser(t *testing.T) {
+	assert := assert.New(t)
+
+	sc := &TestSystemClient{}
+	images := []UserImage{
+		{Name: "skeg-nate-1", Labels: map[string]string{"skeg.io/image/uid": "1000", "skeg.io/image/gid": "1000"}},
+		{Name: "skeg-nate-2", Labels: map[string]string{"skeg.io/image/uid": "501", "skeg.io/image/gid": "20"}},
+		{Name: "skeg-nate-3", Labels: map[string]string{"skeg.io/image/uid": "1000", "skeg.io/image/gid": "20"}},
+		{Name: "skeg-nate-4", Labels: map[string]string{}},
+	}
+
+	filtered := filterImagesForUser(images, sc)
+	assert.Len(filtered, 2)
+	assert.Equal("skeg-nate-1", filtered[0].Name)
+	assert.Equal("skeg-nate-4", filtered[1].Name)
+}
+
+func TestSnapshotEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
+
+	dc := NewTestDockerClient()
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foo",
+			Names:  []string{"/skeg_nate_foo"},
+			Image:  "skeg-nate-1234",
+			Status: "Up 12 hours",
+			Labels: map[string]string{
+				"skeg.io/image/base":     "clojure",
+				"skeg.io/image/username": "nate",
+			},
+		},
+	)
+	dc.AddImage(docker.APIImages{
+		RepoTags: []string{"skeg-nate-1234:latest"},
+		Labels: map[string]string{
+			"skeg.io/image/base":     "clojure",
+			"skeg.io/image/username": "nate",
+		},
+	})
+	sc.EnsureEnvironmentDir("foo")
+
+	_, err := SnapshotEnvironment(dc, sc, "bar", "")
+	assert.Equal(errors.New("bar environment not found"), err)
+
+	_, err = SnapshotEnvironment(dc, sc, "foo", "bad/name")
+	assert.Equal(errors.New("Invalid snapshot name bad/name"), err)
+
+	snap, err := SnapshotEnvironment(dc, sc, "foo", "before-upgrade")
+	assert.Nil(err)
+	assert.Equal("skeg-snap-nate-foo:before-upgrade", snap.Image)
+
+	_, err = SnapshotEnvironment(dc, sc, "foo", "before-upgrade")
+	assert.Equal(errors.New("Snapshot before-upgrade already exists"), err)
+
+	_, err = SnapshotEnvironment(dc, sc, "foo", "after-upgrade")
+	assert.Nil(err)
+
+	snapshots, err := Snapshots(dc, sc, "foo")
+	assert.Nil(err)
+	assert.Len(snapshots, 2)
+	assert.Equal("before-upgrade", snapshots[0].Name)
+	assert.Equal("after-upgrade", snapshots[1].Name)
+
+	snapshots, err = Snapshots(dc, sc, "bar")
+	assert.Nil(err)
+	assert.Len(snapshots, 0)
+
+	// snapshots aren't treated as user images
+	userImages, err := UserImages(dc, sc, ImageOpts{}, -1)
+	assert.Nil(err)
+	assert.Len(userImages, 1)
+	assert.Equal("skeg-nate-1234:latest", userImages[0].Name)
+
+	err = RollbackEnvironment(dc, sc, CreateOpts{Name: "foo"}, "missing", os.Stdout)
+	assert.Equal(errors.New("Snapshot missing not found for foo"), err)
+}
+
+func TestCloneEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
+
+	dc := NewTestDockerClient()
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foo",
+			Names:  []string{"/skeg_nate_foo"},
+			Image:  "skeg-nate-1234",
+			Status: "Up 12 hours",
+		},
+	)
+	sc.EnsureEnvironmentDir("foo")
+	sc.EnsureEnvironmentDir("bar")
+	sc.EnsureEnvironmentDir("baz")
+
+	err := CloneEnvironment(dc, sc, "missing", CreateOpts{Name: "new"}, os.Stdout)
+	assert.Equal(errors.New("missing environment not found"), err)
+
+	err = CloneEnvironment(dc, sc, "bar", CreateOpts{Name: "new"}, os.Stdout)
+	assert.Equal(errors.New("No container found"), err)
+
+	err = CloneEnvironment(dc, sc, "foo", CreateOpts{Name: "baz"}, os.Stdout)
+	assert.Equal(errors.New("Environment baz already exists"), err)
+
+	// the source's host ports are replaced, ones given for the clone are kept
+	dc.containers[0].Ports = []docker.APIPort{{PrivatePort: 3000, PublicPort: 3000, Type: "tcp", IP: "0.0.0.0"}}
+	dc.containers[0].Status = "Exited (0) 1 hour ago"
+	err = CloneEnvironment(dc, sc, "foo", CreateOpts{Name: "new", Ports: []string{"8080:80"}, Build: BuildOpts{Distro: "debian"}}, os.Stdout)
+	assert.Nil(err)
+	created := dc.created[len(dc.created)-1]
+	assert.Equal("skeg_nate_new", created.Name)
+	assert.Equal([]Port{
+		{"", 8080, 80, "tcp"},
+		{"", 0, 22, "tcp"},
+		{"0.0.0.0", 0, 3000, "tcp"},
+	}, created.Ports)
+}
+
+func TestRenameEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
+
+	dc := NewTestDockerClient()
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foo",
+			Names:  []string{"/skeg_nate_foo"},
+			Image:  "skeg-nate-1234",
+			Status: "Up 12 hours",
+		},
+	)
+	sc.EnsureEnvironmentDir("foo")
+	sc.EnsureEnvironmentDir("bar")
+	sc.EnsureEnvironmentDir("baz")
+
+	err := RenameEnvironment(dc, sc, "missing", CreateOpts{Name: "new"}, false, os.Stdout)
+	assert.Equal(errors.New("missing environment not found"), err)
+
+	err = RenameEnvironment(dc, sc, "foo", CreateOpts{Name: "baz"}, false, os.Stdout)
+	assert.Equal(errors.New("Environment baz already exists"), err)
+
+	err = RenameEnvironment(dc, sc, "foo", CreateOpts{Name: "new"}, false, os.Stdout)
+	assert.Equal(errors.New("Environment foo is running, stop it first or use --force"), err)
+
+	// without a container only the directory is renamed
+	err = RenameEnvironment(dc, sc, "bar", CreateOpts{Name: "new"}, false, os.Stdout)
+	assert.Nil(err)
+
+	dirs, _ := sc.EnvironmentDirs()
+	assert.Equal([]string{"baz", "foo", "new"}, dirs)
+}
+
+func TestExecEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
+
+	dc := NewTestDockerClient()
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foo",
+			Names:  []string{"/skeg_nate_foo"},
+			Image:  "skeg-nate-1234",
+			Status: "Up 12 hours",
+		},
+	)
+	sc.EnsureEnvironmentDir("foo")
+
+	_, err := ExecEnvironment(dc, sc, "foo", "", ExecOpts{})
+	assert.Equal(errors.New("No command given"), err)
+
+	var out bytes.Buffer
+	code, err := ExecEnvironment(dc, sc, "foo", "", ExecOpts{Cmd: []string{"ls", "-la"}, Stdout: &out})
+	assert.Nil(err)
+	assert.Equal(0, code)
+	assert.Equal("ran exec1", out.String())
+	assert.Equal("nate", dc.execs[0].User)
+	assert.Equal([]string{"sh", "-c", `cd "$1" && shift && exec "$@"`, "sh", "/home/nate", "ls", "-la"}, dc.execs[0].Cmd)
+
+	dc.exitCode = 3
+	code, err = ExecEnvironment(dc, sc, "foo", "/tmp", ExecOpts{Cmd: []string{"false"}})
+	assert.Nil(err)
+	assert.Equal(3, code)
+	assert.Equal([]string{"sh", "-c", `cd "$1" && shift && exec "$@"`, "sh", "/tmp", "false"}, dc.execs[1].Cmd)
+
+	startError := errors.New("Start error")
+	dc.fails.SetFailure("StartExec", startError)
+	_, err = ExecEnvironment(dc, sc, "foo", "", ExecOpts{Cmd: []string{"true"}})
+	assert.Equal(startError, err)
+}
+
+func TestInstallHostKey(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
+	dc := NewTestDockerClient()
+
+	err := installHostKey(dc, sc, "foo", "skeg_nate_foo")
+	assert.Nil(err)
+
+	key, _ := sc.EnsureHostKey("foo")
+	publicKey, _ := ioutil.ReadFile(key.publicPath)
+	assert.Equal(string(publicKey), dc.files["/etc/ssh/ssh_host_ed25519_key.pub"])
+	assert.Contains(dc.files["/etc/ssh/ssh_host_ed25519_key"], "PRIVATE KEY")
+
+	knownHosts, _ := ioutil.ReadFile(sc.KnownHostsPath())
+	assert.True(strings.HasPrefix(string(knownHosts), "skeg_nate_foo ssh-ed25519 "))
+
+	// the same key is installed again on rebuild
+	dc = NewTestDockerClient()
+	err = installHostKey(dc, sc, "foo", "skeg_nate_foo")
+	assert.Nil(err)
+	assert.Equal(string(publicKey), dc.files["/etc/ssh/ssh_host_ed25519_key.pub"])
+
+	err = removeHostKey(sc, "foo")
+	assert.Nil(err)
+	knownHosts, _ = ioutil.ReadFile(sc.KnownHostsPath())
+	assert.Equal("", string(knownHosts))
+}
+
+func TestSshConfigEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Unsetenv("DOCKER_HOST")
+	sc := NewTestSystemClient()
+
+	dc := NewTestDockerClient()
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foo",
+			Names:  []string{"/skeg_nate_foo"},
+			Image:  "skeg-nate-1234",
+			Status: "Up 12 hours",
+			Ports: []docker.APIPort{
+				{PrivatePort: 22, PublicPort: 32768, Type: "tcp", IP: "0.0.0.0"},
+			},
+			Labels: map[string]string{
+				"skeg.io/container/host_key": "true",
+			},
+		},
+	)
+	sc.EnsureEnvironmentDir("foo")
+
+	config, err := SshConfigEnvironment(dc, sc, "foo")
+	assert.Nil(err)
+	assert.Equal(`Host foo
+  HostName localhost
+  User nate
+  Port 32768
+  UserKnownHostsFile /home/nate/skegs/known_hosts
+  StrictHostKeyChecking yes
+  HostKeyAlias skeg_nate_foo
+  PasswordAuthentication no
+  LogLevel FATAL
+
+`, config)
+}
+
+func TestUpdateSSHConfig(t *testing.T) {
+	assert := assert.New(t)
+	os.Unsetenv("DOCKER_HOST")
+
+	sc := NewTestSystemClient()
+	dc := NewTestDockerClient()
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foo",
+			Names:  []string{"/skeg_nate_foo"},
+			Image:  "skeg-nate-1234",
+			Status: "Exited (0) 1 hour ago",
+			Ports: []docker.APIPort{
+				{PrivatePort: 22, PublicPort: 32768, Type: "tcp", IP: "0.0.0.0"},
+			},
+			Labels: map[string]string{
+				"skeg.io/container/host_key": "true",
+			},
+		},
+	)
+	sc.EnsureEnvironmentDir("foo")
+	sc.EnsureEnvironmentDir("bar")
+
+	// nothing is written until the config is installed
+	_, err := EnsureRunning(dc, sc, "foo")
+	assert.Nil(err)
+	assert.Equal("", sc.sshConfig)
+
+	err = InstallSSHConfig(dc, sc)
+	assert.Nil(err)
+	assert.Equal(`# Managed by skeg, changes will be overwritten.
+
+# skeg-bar isn't running
+
+Host skeg-foo
+  HostName localhost
+  User nate
+  Port 32768
+  UserKnownHostsFile /home/nate/skegs/known_hosts
+  StrictHostKeyChecking yes
+  HostKeyAlias skeg_nate_foo
+  PasswordAuthentication no
+  LogLevel FATAL
+
+`, sc.sshConfig)
+
+	_, err = EnsureStopped(dc, sc, "foo")
+	assert.Nil(err)
+	assert.Contains(sc.sshConfig, "# skeg-foo isn't running\n")
+
+	_, err = EnsureRunning(dc, sc, "foo")
+	assert.Nil(err)
+	assert.Contains(sc.sshConfig, "Host skeg-foo\n")
+
+	err = DestroyEnvironment(dc, sc, "bar")
+	assert.Nil(err)
+	assert.NotContains(sc.sshConfig, "skeg-bar")
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// ArchiveManifest is the metadata stored in an environment archive, enough to
+// recreate the environment with the same settings.
+type ArchiveManifest struct {
+	Version      int                    `json:"version"`
+	Name         string                 `json:"name"`
+	Username     string                 `json:"username"`
+	BaseImage    string                 `json:"baseImage"`
+	UserImage    string                 `json:"userImage,omitempty"`
+	TimeZone     string                 `json:"timeZone"`
+	Distro       string                 `json:"distro"`
+	Ports        []Port                 `json:"ports"`
+	Volumes      []string               `json:"volumes"`
+	ProjectDir   string                 `json:"projectDir"`
+	VolumeHome   bool                   `json:"volumeHome"`
+	DockerSocket bool                   `json:"dockerSocket"`
+	Env          []string               `json:"env"`
+	Resources    ResourceOpts           `json:"resources"`
+	Network      string                 `json:"network,omitempty"`
+	Services     map[string]ServiceSpec `json:"services,omitempty"`
+	Environment  Environment            `json:"environment"`
+}
+
+const (
+	archiveManifest = "skeg.json"
+	archiveImage    = "image.tar"
+	archiveHome     = "home"
+)
+
+// ExportEnvironment writes an archive of an environment to w.  The archive
+// holds the environment's settings, the contents of its home directory and,
+// optionally, its user image.
+func ExportEnvironment(dc DockerClient, sc SystemClient, name string, w io.Writer, includeImage bool) error {
+	env, err := GetEnvironment(dc, sc, name)
+	if err != nil {
+		return err
+	}
+
+	if env.Container == nil {
+		return errors.New("No container found")
+	}
+
+	co, err := MergeEnvironmentOpts(dc, sc, env, CreateOpts{Name: name})
+	if err != nil {
+		return err
+	}
+
+	// the project dir and global mounts are mounted again when the
+	// environment is recreated, so leave them out of the volumes
+	homeDir := fmt.Sprintf("/home/%s", sc.Username())
+	skipped := map[string]bool{}
+	if len(co.ProjectDir) > 0 {
+		skipped[projectMountPath(homeDir, co.ProjectDir)] = true
+	}
+	if globalMounts, ok := env.Container.Labels["skeg.io/container/global_mounts"]; ok && len(globalMounts) > 0 {
+		for _, dest := range strings.Split(globalMounts, ",") {
+			skipped[dest] = true
+		}
+	}
+	volumes := make([]string, 0)
+	for _, v := range co.Volumes {
+		volumeParts := strings.Split(v, ":")
+		if len(volumeParts) > 1 && skipped[volumeParts[1]] {
+			continue
+		}
+		volumes = append(volumes, v)
+	}
+
+	manifest := ArchiveManifest{
+		Version:      ARCHIVE_VERSION,
+		Name:         name,
+		Username:     sc.Username(),
+		BaseImage:    env.Container.Labels["skeg.io/image/base"],
+		TimeZone:     co.Build.TimeZone,
+		Distro:       env.Container.Labels["skeg.io/image/distro"],
+		Ports:        co.ExistingPorts,
+		Volumes:      volumes,
+		ProjectDir:   co.ProjectDir,
+		VolumeHome:   co.VolumeHome,
+		DockerSocket: co.DockerSocket,
+		Env:          co.Env,
+		Resources:    co.Resources,
+		Network:      co.Network,
+		Services:     co.Services,
+		Environment:  env,
+	}
+	if includeImage {
+		manifest.UserImage = env.Container.Image
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	err = writeArchiveFile(tw, archiveManifest, int64(len(data)), strings.NewReader(string(data)))
+	if err != nil {
+		return err
+	}
+
+	if includeImage {
+		fmt.Printf("Saving image %s...\n", env.Container.Image)
+		err = archiveImageFile(dc, tw, env.Container.Image)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Saving home directory...")
+	if co.VolumeHome {
+		err = archiveHomeVolume(dc, tw, env.Container.Name, homeDir, archiveHome)
+	} else {
+		var path string
+		path, err = sc.EnsureEnvironmentDir(name)
+		if err == nil {
+			err = archiveHomeDir(tw, path)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// ImportEnvironment recreates an environment from an archive written by
+// ExportEnvironment.  If name is empty, the archived environment's name is
+// used.  Files in the home directory are owned by the importing user.
+func ImportEnvironment(dc DockerClient, sc SystemClient, path, name string, mounts []MountOpts, output *os.File) error {
+	var manifest ArchiveManifest
+	err := readArchive(path, func(header *tar.Header, r io.Reader) error {
+		switch header.Name {
+		case archiveManifest:
+			return json.NewDecoder(r).Decode(&manifest)
+		case archiveImage:
+			fmt.Println("Loading image...")
+			return dc.LoadImage(r)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if manifest.Version == 0 || manifest.Version > ARCHIVE_VERSION {
+		return fmt.Errorf("Unsupported archive version %d", manifest.Version)
+	}
+
+	if len(name) == 0 {
+		name = manifest.Name
+	}
+
+	envs, err := Environments(dc, sc)
+	if err != nil {
+		return err
+	}
+	if env, ok := envs[name]; env.Container != nil && ok {
+		return fmt.Errorf("Environment %s already exists", name)
+	}
+
+	co := CreateOpts{
+		Name:          name,
+		ExistingPorts: manifest.Ports,
+		Volumes:       manifest.Volumes,
+		VolumeHome:    manifest.VolumeHome,
+		DockerSocket:  manifest.DockerSocket,
+		Env:           manifest.Env,
+		Resources:     manifest.Resources,
+		Network:       manifest.Network,
+		Services:      manifest.Services,
+		Mounts:        mounts,
+		Build: BuildOpts{
+			Image:    ImageOpts{Image: manifest.BaseImage},
+			TimeZone: manifest.TimeZone,
+			Distro:   manifest.Distro,
+			Username: sc.Username(),
+			UID:      sc.UID(),
+			GID:      sc.GID(),
+		},
+	}
+	if _, err := os.Stat(manifest.ProjectDir); len(manifest.ProjectDir) > 0 && err == nil {
+		co.ProjectDir = manifest.ProjectDir
+	}
+
+	if !co.VolumeHome {
+		envPath, err := sc.EnsureEnvironmentDir(name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Restoring home directory...")
+		err = readArchive(path, func(header *tar.Header, r io.Reader) error {
+			return extractHomeFile(envPath, header, r)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = CreateEnvironment(dc, sc, co, output)
+	if err != nil {
+		return err
+	}
+
+	if co.VolumeHome {
+		fmt.Println("Restoring home directory...")
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(rewriteHomeArchive(path, pw, sc.UID(), sc.GID()))
+		}()
+
+		containerName := fmt.Sprintf("%s_%s_%s", CONT_PREFIX, sc.Username(), name)
+		err = dc.UploadToContainer(containerName, fmt.Sprintf("/home/%s", sc.Username()), pr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeArchiveFile(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+// archiveImageFile saves an image into the archive.  The image is spooled to
+// a temp file first, since tar needs to know its size.
+func archiveImageFile(dc DockerClient, tw *tar.Writer, image string) error {
+	tmp, err := ioutil.TempFile("", "skeg-image")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	err = dc.ExportImage(image, tmp)
+	if err != nil {
+		return err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Seek(0, 0)
+	if err != nil {
+		return err
+	}
+
+	return writeArchiveFile(tw, archiveImage, info.Size(), tmp)
+}
+
+// archiveHomeDir adds the contents of a host home directory to the archive.
+func archiveHomeDir(tw *tar.Writer, path string) error {
+	return filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(file)
+			if err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(filepath.Join(archiveHome, rel))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// archiveHomeVolume adds the contents of a home directory stored in a docker
+// volume to the archive under prefix, by copying it out of the container.
+// Other mounts inside the home directory are skipped.
+func archiveHomeVolume(dc DockerClient, tw *tar.Writer, containerName, homeDir, prefix string) error {
+	dockerContainer, err := dc.InspectContainer(containerName)
+	if err != nil {
+		return err
+	}
+
+	homeBase := filepath.Base(homeDir)
+	skipped := make([]string, 0)
+	for _, mount := range dockerContainer.Mounts {
+		if strings.HasPrefix(mount.Destination, homeDir+"/") {
+			skipped = append(skipped, homeBase+strings.TrimPrefix(mount.Destination, homeDir))
+		}
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(dc.DownloadFromContainer(containerName, homeDir, pw))
+	}()
+
+	tr := tar.NewReader(pr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(header.Name, "/")
+		skip := false
+		for _, prefix := range skipped {
+			if name == prefix || strings.HasPrefix(name, prefix+"/") {
+				skip = true
+			}
+		}
+		if skip {
+			continue
+		}
+
+		header.Name = prefix + strings.TrimPrefix(header.Name, homeBase)
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(tw, tr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readArchive calls fn for each entry in an archive.
+func readArchive(path string, fn func(*tar.Header, io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		err = fn(header, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// homeRelPath returns the path of an archive entry relative to the home
+// directory, or false if the entry isn't in the home directory.
+func homeRelPath(name string) (string, bool) {
+	name = strings.TrimSuffix(name, "/")
+	if name == archiveHome {
+		return "", true
+	}
+	if !strings.HasPrefix(name, archiveHome+"/") {
+		return "", false
+	}
+
+	rel := strings.TrimPrefix(name, archiveHome+"/")
+	if strings.Contains("/"+rel+"/", "/../") {
+		return "", false
+	}
+
+	return rel, true
+}
+
+// extractHomeFile writes a home directory entry from an archive into path.
+// Symlinks are recreated as stored, like in a home volume, but archives can
+// come from anywhere, so entries are never written through them.
+func extractHomeFile(path string, header *tar.Header, r io.Reader) error {
+	rel, ok := homeRelPath(header.Name)
+	if !ok || len(rel) == 0 {
+		return nil
+	}
+
+	target := filepath.Join(path, filepath.FromSlash(rel))
+	mode := os.FileMode(header.Mode).Perm()
+
+	err := checkNoSymlinks(path, filepath.Dir(filepath.FromSlash(rel)))
+	if err != nil {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Unable to extract %s, it would be written through a symlink", header.Name)
+		}
+		return os.MkdirAll(target, mode|0700)
+	case tar.TypeSymlink:
+		os.Remove(target)
+		return os.Symlink(header.Linkname, target)
+	case tar.TypeReg, tar.TypeRegA:
+		err := os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+
+		// replace a symlink rather than writing to where it points
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			err = os.Remove(target)
+			if err != nil {
+				return err
+			}
+		}
+
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(f, r)
+		return err
+	default:
+		logrus.Debugf("Skipping %s, unsupported file type", header.Name)
+	}
+
+	return nil
+}
+
+// checkNoSymlinks returns an error if any directory of dir, relative to path,
+// is a symlink.  Directories that don't exist yet are fine.
+func checkNoSymlinks(path, dir string) error {
+	if dir == "." {
+		return nil
+	}
+
+	current := path
+	for _, part := range strings.Split(dir, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Unable to extract into %s, it's a symlink", current)
+		}
+	}
+
+	return nil
+}
+
+// rewriteHomeArchive writes the home directory entries of an archive to w as
+// a tar stream relative to the home directory, owned by uid and gid.
+func rewriteHomeArchive(path string, w io.Writer, uid, gid int) error {
+	tw := tar.NewWriter(w)
+	err := readArchive(path, func(header *tar.Header, r io.Reader) error {
+		rel, ok := homeRelPath(header.Name)
+		if !ok || len(rel) == 0 {
+			return nil
+		}
+
+		header.Name = rel
+		if header.Typeflag == tar.TypeDir {
+			header.Name += "/"
+		}
+		header.Uid = uid
+		header.Gid = gid
+		header.Uname = ""
+		header.Gname = ""
+
+		err := tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// copyHomeDir copies a home directory on the host from one environment
+// directory to another.
+func copyHomeDir(src, dst string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := archiveHomeDir(tw, src)
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	tr := tar.NewReader(pr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		err = extractHomeFile(dst, header, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyHomeVolume copies a home directory stored in a docker volume from one
+// container to another.
+func copyHomeVolume(dc DockerClient, src, dst, homeDir string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := archiveHomeVolume(dc, tw, src, homeDir, filepath.Base(homeDir))
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	return dc.UploadToContainer(dst, filepath.Dir(homeDir), pr)
+}
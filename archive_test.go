@@ -0,0 +1,186 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHomeRelPath(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		name string
+		rel  string
+		ok   bool
+	}{
+		{"home", "", true},
+		{"home/", "", true},
+		{"home/.bashrc", ".bashrc", true},
+		{"home/src/app/", "src/app", true},
+		{"home/../etc/passwd", "", false},
+		{"home/src/../../etc", "", false},
+		{"skeg.json", "", false},
+		{"homework/file", "", false},
+	}
+
+	for _, test := range tests {
+		rel, ok := homeRelPath(test.name)
+		assert.Equal(test.ok, ok, test.name)
+		assert.Equal(test.rel, rel, test.name)
+	}
+}
+
+func TestCopyHomeDir(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	src := filepath.Join(tempdir, "src")
+	dst := filepath.Join(tempdir, "dst")
+	os.MkdirAll(filepath.Join(src, ".config", "app"), 0755)
+	os.MkdirAll(dst, 0755)
+	ioutil.WriteFile(filepath.Join(src, ".bashrc"), []byte("export FOO=bar\n"), 0644)
+	ioutil.WriteFile(filepath.Join(src, ".config", "app", "settings"), []byte("a=1\n"), 0600)
+	os.Symlink(".bashrc", filepath.Join(src, ".profile"))
+
+	err := copyHomeDir(src, dst)
+	assert.Nil(err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, ".bashrc"))
+	assert.Nil(err)
+	assert.Equal("export FOO=bar\n", string(data))
+
+	info, err := os.Stat(filepath.Join(dst, ".config", "app", "settings"))
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	link, err := os.Readlink(filepath.Join(dst, ".profile"))
+	assert.Nil(err)
+	assert.Equal(".bashrc", link)
+}
+
+func TestExtractHomeFileSymlinks(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	home := filepath.Join(tempdir, "home")
+	outside := filepath.Join(tempdir, "outside")
+	os.MkdirAll(home, 0755)
+	os.MkdirAll(outside, 0755)
+
+	extract := func(header *tar.Header, contents string) error {
+		header.Size = int64(len(contents))
+		return extractHomeFile(home, header, strings.NewReader(contents))
+	}
+
+	// links are kept as stored, wherever they point
+	links := map[string]string{
+		"etc":      outside,
+		"up":       "../outside",
+		".vimrc":   "/home/nate/dotfiles/vimrc",
+		".profile": ".bashrc",
+	}
+	for name, target := range links {
+		err := extract(&tar.Header{Name: "home/" + name, Typeflag: tar.TypeSymlink, Linkname: target}, "")
+		assert.Nil(err)
+
+		link, err := os.Readlink(filepath.Join(home, name))
+		assert.Nil(err)
+		assert.Equal(target, link)
+	}
+
+	// but nothing is written through them
+	err := extract(&tar.Header{Name: "home/etc/passwd", Typeflag: tar.TypeReg, Mode: 0644}, "root")
+	assert.NotNil(err)
+
+	// nothing is written through a symlink already in the home directory
+	os.Symlink(outside, filepath.Join(home, "existing"))
+	err = extract(&tar.Header{Name: "home/existing/passwd", Typeflag: tar.TypeReg, Mode: 0644}, "root")
+	assert.Equal(fmt.Errorf("Unable to extract into %s, it's a symlink", filepath.Join(home, "existing")), err)
+	err = extract(&tar.Header{Name: "home/existing/dir/", Typeflag: tar.TypeDir, Mode: 0755}, "")
+	assert.NotNil(err)
+
+	os.Symlink(filepath.Join(outside, "file"), filepath.Join(home, "file"))
+	err = extract(&tar.Header{Name: "home/file", Typeflag: tar.TypeReg, Mode: 0644}, "data")
+	assert.Nil(err)
+
+	files, _ := ioutil.ReadDir(outside)
+	assert.Equal(0, len(files))
+	data, _ := ioutil.ReadFile(filepath.Join(home, "file"))
+	assert.Equal("data", string(data))
+}
+
+func TestExportEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	// the test system client keeps environment dirs relative to the cwd
+	cwd, _ := os.Getwd()
+	os.Chdir(tempdir)
+	defer os.Chdir(cwd)
+
+	projectDir := filepath.Join(tempdir, "project")
+	os.MkdirAll(projectDir, 0755)
+	ioutil.WriteFile(filepath.Join(projectDir, PROJECT_FILE), []byte("type: go\n"), 0644)
+	os.MkdirAll("foo", 0755)
+	ioutil.WriteFile(filepath.Join("foo", ".bashrc"), []byte("export FOO=bar\n"), 0644)
+
+	sc := NewTestSystemClient()
+	sc.EnsureEnvironmentDir("foo")
+	dc := NewTestDockerClient()
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foo",
+			Names:  []string{"/skeg_nate_foo"},
+			Image:  "skeg-nate-go:latest",
+			Status: "Exited (0) 1 hour ago",
+			Labels: map[string]string{
+				"skeg.io/image/base":            "skegio/go:1.7",
+				"skeg.io/image/timezone":        "America/Los_Angeles",
+				"skeg.io/container/project_dir": projectDir,
+			},
+		},
+	)
+
+	var buf bytes.Buffer
+	err := ExportEnvironment(dc, sc, "foo", &buf, false)
+	assert.Nil(err)
+
+	gr, err := gzip.NewReader(&buf)
+	assert.Nil(err)
+	tr := tar.NewReader(gr)
+
+	var manifest ArchiveManifest
+	names := make([]string, 0)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+		if header.Name == archiveManifest {
+			json.NewDecoder(tr).Decode(&manifest)
+		}
+	}
+
+	assert.Equal([]string{"skeg.json", "home/", "home/.bashrc"}, names)
+	assert.Equal("skegio/go:1.7", manifest.BaseImage)
+	assert.Equal("America/Los_Angeles", manifest.TimeZone)
+	assert.Equal(projectDir, manifest.ProjectDir)
+}
@@ -11,6 +11,7 @@ type BuildCommand struct {
 	Image     string `short:"i" long:"image" description:"Image to use for creating environment."`
 	ForcePull bool   `long:"force-pull" description:"Force pulling base image."`
 	TimeZone  string `long:"tz" description:"Time zone for container, specify like 'America/Los_Angeles'.  Defaults to local time zone, if detectable."`
+	Distro    string `long:"distro" description:"Distribution family of the image (debian, alpine, fedora, arch).  Detected from the image if not given."`
 }
 
 var buildCommand BuildCommand
@@ -23,6 +24,7 @@ func (ccommand *BuildCommand) toBuildOpts(sc SystemClient) BuildOpts {
 			Image:   ccommand.Image,
 		},
 		TimeZone:  ccommand.TimeZone,
+		Distro:    ccommand.Distro,
 		ForcePull: ccommand.ForcePull,
 		Username:  sc.Username(),
 		UID:       sc.UID(),
@@ -36,7 +38,12 @@ func (x *BuildCommand) Execute(args []string) error {
 		return err
 	}
 
-	sc, err := NewSystemClient()
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
 	if err != nil {
 		return err
 	}
@@ -46,7 +53,7 @@ func (x *BuildCommand) Execute(args []string) error {
 		return err
 	}
 
-	image, err := BuildImage(dc, sc, key, buildCommand.toBuildOpts(sc), os.Stdout)
+	image, err := BuildImage(dc, sc, key, cfg.MergeBuildOpts(buildCommand.toBuildOpts(sc)), os.Stdout)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultCatalog lists the predefined images published under DOCKER_HUB_ORG.
+// Teams can add their own images (or replace these) with catalog files.
+const defaultCatalog = `
+images:
+  - name: go
+    description: Golang Image
+    tags:
+      - name: "1.4"
+      - name: "1.5"
+      - name: "1.6"
+      - name: "1.7"
+        preferred: true
+      - name: "1.8"
+  - name: clojure
+    description: Clojure image
+    tags:
+      - name: java7
+      - name: java8
+        preferred: true
+  - name: python
+    description: Python base image
+    tags:
+      - name: both
+        preferred: true
+      - name: "2.7"
+      - name: "3.5"
+`
+
+type catalogFile struct {
+	Images []struct {
+		Name        string `yaml:"name"`
+		Description string `yaml:"description"`
+		Org         string `yaml:"org"`
+		Tags        []struct {
+			Name      string `yaml:"name"`
+			Preferred bool   `yaml:"preferred"`
+		} `yaml:"tags"`
+	} `yaml:"images"`
+}
+
+func mustParseCatalog(data string) []*BaseImage {
+	images, err := ParseCatalog([]byte(data))
+	if err != nil {
+		panic(err)
+	}
+
+	return images
+}
+
+// ParseCatalog reads base images from catalog file data.  Images without an
+// org are assumed to be under DOCKER_HUB_ORG.
+func ParseCatalog(data []byte) ([]*BaseImage, error) {
+	var cf catalogFile
+	err := yaml.UnmarshalStrict(data, &cf)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]*BaseImage, 0)
+	for _, im := range cf.Images {
+		if len(im.Name) == 0 {
+			return nil, fmt.Errorf("Catalog image without a name")
+		}
+
+		org := im.Org
+		if len(org) == 0 {
+			org = DOCKER_HUB_ORG
+		}
+
+		tags := make([]*BaseImageTag, 0)
+		for _, tag := range im.Tags {
+			tags = append(tags, &BaseImageTag{tag.Name, false, tag.Preferred})
+		}
+
+		images = append(images, &BaseImage{im.Name, im.Description, org, tags})
+	}
+
+	return images, nil
+}
+
+// MergeCatalogs combines catalogs, in order.  An image in a later catalog
+// replaces an earlier image with the same name.
+func MergeCatalogs(catalogs ...[]*BaseImage) []*BaseImage {
+	merged := make([]*BaseImage, 0)
+	positions := make(map[string]int)
+
+	for _, catalog := range catalogs {
+		for _, im := range catalog {
+			if pos, ok := positions[im.Name]; ok {
+				merged[pos] = im
+			} else {
+				positions[im.Name] = len(merged)
+				merged = append(merged, im)
+			}
+		}
+	}
+
+	return merged
+}
+
+func readCatalog(location string) ([]byte, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		client := http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Unable to fetch catalog %s: %s", location, resp.Status)
+		}
+
+		return ioutil.ReadAll(resp.Body)
+	}
+
+	path, err := expandHome(location)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+// LoadCatalogs builds the image catalog from the built in catalog, the user's
+// catalog file (if present) and any catalogs listed in the config, which may
+// be paths or URLs.
+func LoadCatalogs(cfg Config) ([]*BaseImage, error) {
+	catalogs := [][]*BaseImage{mustParseCatalog(defaultCatalog)}
+
+	locations := make([]string, 0)
+	if path, err := DefaultConfigPath(); err == nil {
+		userCatalog := filepath.Join(filepath.Dir(path), CATALOG_FILE)
+		if _, err := os.Stat(userCatalog); err == nil {
+			locations = append(locations, userCatalog)
+		}
+	}
+	locations = append(locations, cfg.Catalogs...)
+
+	for _, location := range locations {
+		logrus.Debugf("Loading image catalog %s", location)
+		data, err := readCatalog(location)
+		if err != nil {
+			return nil, err
+		}
+
+		catalog, err := ParseCatalog(data)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse catalog %s: %s", location, err)
+		}
+		catalogs = append(catalogs, catalog)
+	}
+
+	return MergeCatalogs(catalogs...), nil
+}
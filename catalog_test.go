@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadCatalogs(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	oldHome := os.Getenv(HOME_ENV_NAME)
+	os.Setenv(HOME_ENV_NAME, tempdir)
+	defer os.Setenv(HOME_ENV_NAME, oldHome)
+
+	os.MkdirAll(filepath.Join(tempdir, CONFIG_DIR), 0755)
+	ioutil.WriteFile(filepath.Join(tempdir, CONFIG_DIR, CATALOG_FILE), []byte(`
+images:
+  - name: go
+    description: Newer Go
+    tags:
+      - name: "1.9"
+        preferred: true
+`), 0644)
+
+	teamCatalog := filepath.Join(tempdir, "team.yml")
+	ioutil.WriteFile(teamCatalog, []byte(`
+images:
+  - name: node
+    description: Team node image
+    org: registry.example.com/team
+    tags:
+      - name: "8"
+        preferred: true
+`), 0644)
+
+	catalog, err := LoadCatalogs(Config{Catalogs: []string{teamCatalog}})
+	assert.Nil(err)
+
+	sc := NewTestSystemClient()
+	sc.catalog = catalog
+	dc := NewTestDockerClient()
+	dc.AddImage(docker.APIImages{RepoTags: []string{"registry.example.com/team/node:8"}})
+
+	baseImages, err := BaseImages(dc, sc)
+	assert.Nil(err)
+	assert.Equal([]*BaseImage{
+		{"go", "Newer Go", "skegio", []*BaseImageTag{{"1.9", false, true}}},
+		{"clojure", "Clojure image", "skegio", []*BaseImageTag{{"java7", false, false}, {"java8", false, true}}},
+		{"python", "Python base image", "skegio", []*BaseImageTag{{"both", false, true}, {"2.7", false, false}, {"3.5", false, false}}},
+		{"node", "Team node image", "registry.example.com/team", []*BaseImageTag{{"8", true, true}}},
+	}, baseImages)
+
+	image, err := ResolveImage(dc, sc, ImageOpts{Type: "node"})
+	assert.Nil(err)
+	assert.Equal("registry.example.com/team/node:8", image)
+
+	_, err = LoadCatalogs(Config{Catalogs: []string{filepath.Join(tempdir, "missing.yml")}})
+	assert.NotNil(err)
+}
+
+func TestSystemClientDefersCatalogs(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	// commands that don't look up base images don't read catalogs
+	sc, err := NewSystemClientWithBase(tempdir, Config{Catalogs: []string{"http://127.0.0.1:1/catalog.yml"}})
+	assert.Nil(err)
+
+	_, err = BaseImages(NewTestDockerClient(), sc)
+	assert.NotNil(err)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type CloneCommand struct {
+	Args struct {
+		Source      string `description:"Name of environment to clone."`
+		Destination string `description:"Name of new environment."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var cloneCommand CloneCommand
+
+func (x *CloneCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	co := CreateOpts{
+		Name:   cloneCommand.Args.Destination,
+		Mounts: cfg.Mounts,
+		Build: BuildOpts{
+			Username: sc.Username(),
+			UID:      sc.UID(),
+			GID:      sc.GID(),
+		},
+	}
+
+	return CloneEnvironment(dc, sc, cloneCommand.Args.Source, co, os.Stdout)
+}
+
+func init() {
+	_, err := parser.AddCommand("clone",
+		"Clone an environment.",
+		"Create a new environment with the same settings and a copy of the home directory of an existing one.",
+		&cloneCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import "fmt"
+
+type ConfigCommand struct {
+	// only subcommands
+}
+
+type ConfigShowCommand struct {
+	BuildCommand
+	Ports      []string `short:"p" long:"port" description:"Ports to expose (similar to docker -p)."`
+	Volumes    []string `long:"volume" description:"Volume to mount (similar to docker -v)."`
+	ForceBuild bool     `long:"force-build" description:"Force building of new user image."`
+	VolumeHome bool     `long:"volume-home" description:"Use docker volume for homedir instead of skeg dir"`
+	Docker     bool     `long:"docker" description:"Mount the Docker socket inside the environment."`
+}
+
+func (ccommand *ConfigShowCommand) toCreateOpts(sc SystemClient) CreateOpts {
+	return CreateOpts{
+		Ports:        ccommand.Ports,
+		Volumes:      ccommand.Volumes,
+		VolumeHome:   ccommand.VolumeHome,
+		DockerSocket: ccommand.Docker,
+		ForceBuild:   ccommand.ForceBuild || ccommand.ForcePull,
+		Build:        ccommand.toBuildOpts(sc),
+	}
+}
+
+var configCommand ConfigCommand
+var configShowCommand ConfigShowCommand
+
+func (x *ConfigShowCommand) Execute(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, setting := range cfg.Settings(sc, configShowCommand.toCreateOpts(sc)) {
+		fmt.Printf("%-12s %-30s [%s]\n", setting.Name, setting.Value, setting.Source)
+	}
+
+	return nil
+}
+
+func init() {
+	cmd, err := parser.AddCommand("config",
+		"Work with the skeg config file.",
+		"",
+		&configCommand)
+
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	_, err = cmd.AddCommand("show",
+		"Show the settings used when creating environments.",
+		"Show the settings used when creating environments, merged from command line flags, the config file and defaults.",
+		&configShowCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+)
 
 type ConnectCommand struct {
 	Args struct {
@@ -17,12 +20,22 @@ func (x *ConnectCommand) Execute(args []string) error {
 		return err
 	}
 
-	sc, err := NewSystemClient()
+	cfg, err := loadConfig()
 	if err != nil {
 		return err
 	}
 
-	return ConnectEnvironment(dc, sc, connectCommand.Args.Name, connectCommand.Args.Rest)
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = ConnectEnvironment(dc, sc, connectCommand.Args.Name, connectCommand.Args.Rest)
+	if exitErr, ok := err.(*ExitError); ok {
+		os.Exit(exitErr.Code)
+	}
+
+	return err
 }
 
 func init() {
@@ -7,6 +7,9 @@ const CONT_PREFIX string = "skeg"
 // predefined images can be found.
 const DOCKER_HUB_ORG string = "skegio"
 
+// CATALOG_FILE is the name of the user's base image catalog in CONFIG_DIR.
+const CATALOG_FILE string = "catalog.yml"
+
 // ENVS_DIR is the directory in the user's homedir where data is created
 const ENVS_DIR string = "skegs"
 
@@ -17,4 +20,44 @@ const ENVS_DIR string = "skegs"
 //  version 0: user/tz creation
 //  version 1: ssh key inclusion
 //  version 2: ssh key flexibility (prev ssh work was too restrictive)
-const IMAGE_VERSION int = 2
+//  version 3: ssh key fingerprint label, to rebuild when the key changes
+const IMAGE_VERSION int = 3
+
+// ARCHIVE_VERSION is the format version of environment archives written by
+// freeze and export.
+const ARCHIVE_VERSION int = 1
+
+// FORWARDS_FILE is the name of the file in the skeg dir that tracks port
+// forwards added to running environments.
+const FORWARDS_FILE string = "forwards.json"
+
+// KNOWN_HOSTS_FILE is the name of the file in the skeg dir that holds the
+// host keys of environments.
+const KNOWN_HOSTS_FILE string = "known_hosts"
+
+// SSH_CONFIG_DIR is the directory in the user's homedir holding the ssh
+// client config.
+const SSH_CONFIG_DIR string = ".ssh"
+
+// SSH_CONFIG_INCLUDE is the ssh config file managed by skeg, relative to
+// SSH_CONFIG_DIR, with a Host entry for every environment.
+const SSH_CONFIG_INCLUDE string = "config.d/skeg"
+
+// SSH_HOST_PREFIX is prepended to environment names for their Host entries in
+// the managed ssh config.
+const SSH_HOST_PREFIX string = "skeg-"
+
+// CONFIG_DIR is the directory in the user's homedir where skeg configuration
+// lives.
+const CONFIG_DIR string = ".skeg"
+
+// CONFIG_FILE is the name of the user level config file in CONFIG_DIR.
+const CONFIG_FILE string = "config"
+
+// PROJECT_FILE is the name of the file in a project directory that describes
+// the project's environment.
+const PROJECT_FILE string = ".skeg.yml"
+
+// MIN_DOCKER_API_VERSION is the oldest docker API skeg works with, the first
+// supporting pids limits.
+const MIN_DOCKER_API_VERSION string = "1.23"
@@ -5,16 +5,49 @@ import (
 	"os"
 )
 
+// ResourceCommand holds the resource limit options of create, run and
+// rebuild.
+type ResourceCommand struct {
+	CPUs       string `long:"cpus" description:"Number of CPUs the environment can use, like 1.5."`
+	Memory     string `long:"memory" description:"Memory limit, like 4g."`
+	MemorySwap string `long:"memory-swap" description:"Memory plus swap limit, like 8g, or --memory-swap=-1 for unlimited swap."`
+	PidsLimit  int64  `long:"pids-limit" description:"Maximum number of processes."`
+}
+
+func (rcommand *ResourceCommand) toResourceOpts() ResourceOpts {
+	return ResourceOpts{
+		CPUs:       rcommand.CPUs,
+		Memory:     rcommand.Memory,
+		MemorySwap: rcommand.MemorySwap,
+		PidsLimit:  rcommand.PidsLimit,
+	}
+}
+
+// EnvCommand holds the environment variable options of create, run and
+// rebuild.
+type EnvCommand struct {
+	Env     []string `short:"e" long:"env" description:"Environment variable to set, like KEY=VAL, or KEY to take it from the local environment."`
+	EnvFile []string `long:"env-file" description:"File of environment variables to set, one KEY=VAL per line."`
+}
+
+func (ecommand *EnvCommand) toEnv() ([]string, error) {
+	return ParseEnv(ecommand.Env, ecommand.EnvFile)
+}
+
 type CreateCommand struct {
 	BuildCommand
+	ResourceCommand
+	EnvCommand
 	Directory  string   `short:"d" long:"directory" description:"Directory to mount inside (defaults to $PWD)."`
 	Ports      []string `short:"p" long:"port" description:"Ports to expose (similar to docker -p)."`
 	Volumes    []string `long:"volume" description:"Volume to mount (similar to docker -v)."`
 	ForceBuild bool     `long:"force-build" description:"Force building of new user image."`
 	VolumeHome bool     `long:"volume-home" description:"Use docker volume for homedir instead of skeg dir"`
+	Docker     bool     `long:"docker" description:"Mount the Docker socket inside the environment."`
+	Network    string   `long:"network" description:"Docker network to join, created if missing (defaults to skeg_<user>, shared by all your environments)."`
 	Args       struct {
-		Name string `description:"Name of environment."`
-	} `positional-args:"yes" required:"yes"`
+		Name string `description:"Name of environment (defaults to name in .skeg.yml)."`
+	} `positional-args:"yes"`
 }
 
 func (ccommand *CreateCommand) toCreateOpts(sc SystemClient, workingDir string) CreateOpts {
@@ -25,12 +58,15 @@ func (ccommand *CreateCommand) toCreateOpts(sc SystemClient, workingDir string)
 		projectDir = workingDir
 	}
 	return CreateOpts{
-		Name:       ccommand.Args.Name,
-		ProjectDir: projectDir,
-		Ports:      ccommand.Ports,
-		Volumes:    ccommand.Volumes,
-		VolumeHome: ccommand.VolumeHome,
-		ForceBuild: ccommand.ForceBuild || ccommand.ForcePull,
+		Name:         ccommand.Args.Name,
+		ProjectDir:   projectDir,
+		Ports:        ccommand.Ports,
+		Volumes:      ccommand.Volumes,
+		VolumeHome:   ccommand.VolumeHome,
+		DockerSocket: ccommand.Docker,
+		ForceBuild:   ccommand.ForceBuild || ccommand.ForcePull,
+		Resources:    ccommand.toResourceOpts(),
+		Network:      ccommand.Network,
 		Build: BuildOpts{
 			Image: ImageOpts{
 				Type:    ccommand.Type,
@@ -38,6 +74,7 @@ func (ccommand *CreateCommand) toCreateOpts(sc SystemClient, workingDir string)
 				Image:   ccommand.Image,
 			},
 			TimeZone:  ccommand.TimeZone,
+			Distro:    ccommand.Distro,
 			ForcePull: ccommand.ForcePull,
 			Username:  sc.Username(),
 			UID:       sc.UID(),
@@ -54,7 +91,12 @@ func (x *CreateCommand) Execute(args []string) error {
 		return err
 	}
 
-	sc, err := NewSystemClient()
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
 	if err != nil {
 		return err
 	}
@@ -64,7 +106,18 @@ func (x *CreateCommand) Execute(args []string) error {
 		return err
 	}
 
-	return CreateNewEnvironment(dc, sc, createCommand.toCreateOpts(sc, workingDir), os.Stdout)
+	co := createCommand.toCreateOpts(sc, workingDir)
+	co.Env, err = createCommand.toEnv()
+	if err != nil {
+		return err
+	}
+
+	co, err = ApplyProjectSpec(co)
+	if err != nil {
+		return err
+	}
+
+	return CreateNewEnvironment(dc, sc, cfg.MergeCreateOpts(co), os.Stdout)
 }
 
 func init() {
@@ -16,7 +16,12 @@ func (x *DestroyCommand) Execute(args []string) error {
 		return err
 	}
 
-	sc, err := NewSystemClient()
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// Check is the result of one of doctor's checks, with a hint on how to fix
+// it when it doesn't pass.
+type Check struct {
+	Name    string `json:"name" yaml:"name"`
+	Status  string `json:"status" yaml:"status"`
+	Message string `json:"message" yaml:"message"`
+	Hint    string `json:"hint,omitempty" yaml:"hint,omitempty"`
+}
+
+// checkUserEnv checks the variables skeg finds the user and the skeg dir
+// with, which are needed before a SystemClient can be created.
+func checkUserEnv() []Check {
+	checks := make([]Check, 0)
+
+	for _, name := range []string{USER_ENV_NAME, HOME_ENV_NAME} {
+		check := Check{Name: "$" + name, Status: checkPass}
+		if value := os.Getenv(name); len(value) > 0 {
+			check.Message = value
+		} else {
+			check.Status = checkFail
+			check.Message = "not set"
+			check.Hint = fmt.Sprintf("Set $%s in your shell's environment", name)
+		}
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+// checkDockerTLS checks that the TLS settings in the environment and the
+// global options agree with each other, the way connectDocker uses them.
+func checkDockerTLS() Check {
+	check := Check{Name: "docker tls", Status: checkPass}
+
+	verify := os.Getenv("DOCKER_TLS_VERIFY") == "1" || globalOptions.TLSVerify
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	flags := map[string]string{
+		"--tlscert":   globalOptions.TLSCert,
+		"--tlskey":    globalOptions.TLSKey,
+		"--tlscacert": globalOptions.TLSCaCert,
+	}
+
+	given := make([]string, 0)
+	missing := make([]string, 0)
+	for _, flag := range []string{"--tlscert", "--tlskey", "--tlscacert"} {
+		if len(flags[flag]) > 0 {
+			given = append(given, flag)
+		} else {
+			missing = append(missing, flag)
+		}
+	}
+
+	if !verify {
+		check.Message = "not used"
+		if len(certPath) > 0 || len(given) > 0 {
+			check.Status = checkWarn
+			check.Message = "certs are given but TLS verification is off, they're ignored"
+			check.Hint = "Set DOCKER_TLS_VERIFY=1 or pass --tlsverify to use them"
+		}
+		return check
+	}
+
+	files := make([]string, 0)
+	if len(certPath) > 0 {
+		for _, name := range []string{"cert.pem", "key.pem", "ca.pem"} {
+			files = append(files, filepath.Join(certPath, name))
+		}
+		check.Message = fmt.Sprintf("using certs in %s", certPath)
+
+		if len(given) > 0 {
+			check.Status = checkWarn
+			check.Message += fmt.Sprintf(", %s ignored", strings.Join(given, ", "))
+			check.Hint = "Unset DOCKER_CERT_PATH to use the certs given on the command line"
+		}
+	} else if len(missing) == 0 {
+		files = append(files, globalOptions.TLSCert, globalOptions.TLSKey, globalOptions.TLSCaCert)
+		check.Message = "using certs given on the command line"
+	} else {
+		check.Status = checkFail
+		check.Message = "TLS verification requested but certs not specified"
+		check.Hint = fmt.Sprintf("Set DOCKER_CERT_PATH or pass %s", strings.Join(missing, ", "))
+		return check
+	}
+
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			check.Status = checkFail
+			check.Message = fmt.Sprintf("cert %s not found", file)
+			check.Hint = "Check DOCKER_CERT_PATH or the --tls options, `docker-machine env` prints the right settings for a machine"
+			break
+		}
+	}
+
+	return check
+}
+
+// checkDocker checks the docker daemon can be reached and is new enough.
+func checkDocker(dc DockerClient) Check {
+	check := Check{Name: "docker", Status: checkPass}
+
+	version, apiVersion, err := dc.ServerVersion()
+	if err != nil {
+		check.Status = checkFail
+		check.Message = fmt.Sprintf("unable to reach %s: %s", dockerEndpoint(), err)
+		check.Hint = "Check the docker daemon is running and DOCKER_HOST or --host points to it"
+		return check
+	}
+
+	check.Message = fmt.Sprintf("docker %s, API %s at %s", version, apiVersion, dockerEndpoint())
+	if apiVersionBelow(apiVersion, MIN_DOCKER_API_VERSION) {
+		check.Status = checkFail
+		check.Hint = fmt.Sprintf("skeg needs docker API %s or later, upgrade docker", MIN_DOCKER_API_VERSION)
+	}
+
+	return check
+}
+
+// apiVersionBelow compares docker API versions like "1.23".
+func apiVersionBelow(version, min string) bool {
+	parse := func(v string) []int {
+		parts := make([]int, 0)
+		for _, part := range strings.Split(v, ".") {
+			n, _ := strconv.Atoi(part)
+			parts = append(parts, n)
+		}
+		return parts
+	}
+
+	a := parse(version)
+	b := parse(min)
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+
+	return len(a) < len(b)
+}
+
+// checkSSH checks the commands skeg runs and the ssh key it connects with.
+func checkSSH(sc SystemClient) []Check {
+	checks := make([]Check, 0)
+
+	check := Check{Name: "ssh", Status: checkPass, Message: "found"}
+	if !sc.CommandAvailable("ssh") {
+		check.Status = checkWarn
+		check.Message = "not found, the built in ssh client is used"
+		check.Hint = "Install OpenSSH for ssh-config and port forwards through ssh"
+	}
+	if sc.UseNativeSSH() {
+		check.Message += ", connecting with the built in client"
+	}
+	checks = append(checks, check)
+
+	check = Check{Name: "ssh-keygen", Status: checkPass, Message: "found"}
+	if !sc.CommandAvailable("ssh-keygen") {
+		check.Status = checkFail
+		check.Message = "not found, ssh keys can't be generated"
+		check.Hint = "Install OpenSSH"
+	}
+	checks = append(checks, check)
+
+	check = Check{Name: "ssh key", Status: checkPass}
+	path, err := sc.CheckSSHKey()
+	switch {
+	case err == ErrSSHKeyNotCreated:
+		check.Message = fmt.Sprintf("%s will be created with the first environment", path)
+	case err != nil:
+		check.Status = checkFail
+		check.Message = err.Error()
+		check.Hint = "Fix the key's permissions with `chmod 600`, or check the ssh_key and ssh_agent settings in the config"
+	default:
+		check.Message = path
+	}
+	checks = append(checks, check)
+
+	return checks
+}
+
+// checkLegacyContainers looks for containers named like before usernames
+// were part of container names, which aren't associated with environments.
+func checkLegacyContainers(dc DockerClient, sc SystemClient) ([]Check, error) {
+	checks := make([]Check, 0)
+
+	dirs, err := sc.EnvironmentDirs()
+	if err != nil {
+		return checks, err
+	}
+
+	containers, err := dc.ListContainers()
+	if err != nil {
+		return checks, err
+	}
+
+	names := make(map[string]bool)
+	for _, cont := range containers {
+		names[strings.TrimPrefix(cont.Names[0], "/")] = true
+	}
+
+	for _, dir := range dirs {
+		oldContName := fmt.Sprintf("%s_%s", CONT_PREFIX, dir)
+		contName := fmt.Sprintf("%s_%s_%s", CONT_PREFIX, sc.Username(), dir)
+		if names[oldContName] {
+			checks = append(checks, Check{
+				Name:    "legacy container",
+				Status:  checkWarn,
+				Message: fmt.Sprintf("container %s may belong to environment %s", oldContName, dir),
+				Hint:    fmt.Sprintf("Run `docker rename %s %s` to re-associate it", oldContName, contName),
+			})
+		}
+	}
+
+	if len(checks) == 0 {
+		checks = append(checks, Check{Name: "legacy containers", Status: checkPass, Message: "none found"})
+	}
+
+	return checks, nil
+}
+
+// checkImageVersions looks for user images built before the current image
+// capabilities.
+func checkImageVersions(dc DockerClient, sc SystemClient) ([]Check, error) {
+	checks := make([]Check, 0)
+
+	images, err := UserImages(dc, sc, ImageOpts{}, -1)
+	if err != nil {
+		return checks, err
+	}
+
+	for _, im := range images {
+		if im.Version >= IMAGE_VERSION {
+			continue
+		}
+
+		check := Check{
+			Name:    "image version",
+			Status:  checkWarn,
+			Message: fmt.Sprintf("image %s is version %d, current is %d", im.Name, im.Version, IMAGE_VERSION),
+			Hint:    "Run `skeg gc` to remove it",
+		}
+		if len(im.EnvList) > 0 {
+			envs := make([]string, 0)
+			for _, cont := range im.EnvList {
+				envs = append(envs, strings.TrimPrefix(cont, fmt.Sprintf("/%s_%s_", CONT_PREFIX, sc.Username())))
+			}
+			sort.Strings(envs)
+			check.Hint = fmt.Sprintf("Rebuild %s with `skeg rebuild`", strings.Join(envs, ", "))
+		}
+		checks = append(checks, check)
+	}
+
+	if len(checks) == 0 {
+		checks = append(checks, Check{Name: "image versions", Status: checkPass, Message: fmt.Sprintf("all images are version %d", IMAGE_VERSION)})
+	}
+
+	return checks, nil
+}
+
+// checkSSHD checks that sshd answers in every running environment.
+func checkSSHD(dc DockerClient, sc SystemClient) ([]Check, error) {
+	checks := make([]Check, 0)
+
+	envs, err := Environments(dc, sc)
+	if err != nil {
+		return checks, err
+	}
+
+	for _, env := range sortedEnvironments(envs) {
+		if env.Container == nil || !env.Container.Running {
+			continue
+		}
+
+		check := Check{Name: "sshd " + env.Name, Status: checkPass}
+		host, port, err := containerSshHostPort(env)
+		if err == nil {
+			err = sc.CheckSSHPort(host, port)
+			check.Message = fmt.Sprintf("answering on %s:%d", host, port)
+		}
+		if err != nil {
+			check.Status = checkFail
+			check.Message = err.Error()
+			check.Hint = fmt.Sprintf("Restart it with `skeg stop %s && skeg start %s`, or rebuild it", env.Name, env.Name)
+		}
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
+
+// Diagnose runs the checks that need docker and the skeg dir.  A check that
+// can't be run at all is reported as failing.
+func Diagnose(dc DockerClient, sc SystemClient) []Check {
+	checks := checkSSH(sc)
+
+	docker := checkDocker(dc)
+	checks = append(checks, docker)
+	if docker.Status == checkFail {
+		return checks
+	}
+
+	runs := []struct {
+		name string
+		run  func(DockerClient, SystemClient) ([]Check, error)
+	}{
+		{"legacy containers", checkLegacyContainers},
+		{"image versions", checkImageVersions},
+		{"sshd", checkSSHD},
+	}
+	for _, r := range runs {
+		results, err := r.run(dc, sc)
+		if err != nil {
+			results = append(results, Check{Name: r.name, Status: checkFail, Message: err.Error()})
+		}
+		checks = append(checks, results...)
+	}
+
+	return checks
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDockerTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Unsetenv("DOCKER_TLS_VERIFY")
+	defer os.Unsetenv("DOCKER_CERT_PATH")
+	defer func() { globalOptions = GlobalOptions{} }()
+
+	os.Unsetenv("DOCKER_TLS_VERIFY")
+	os.Unsetenv("DOCKER_CERT_PATH")
+	assert.Equal(Check{Name: "docker tls", Status: checkPass, Message: "not used"}, checkDockerTLS())
+
+	globalOptions.TLSCert = "cert.pem"
+	assert.Equal(checkWarn, checkDockerTLS().Status)
+
+	globalOptions.TLSVerify = true
+	check := checkDockerTLS()
+	assert.Equal(checkFail, check.Status)
+	assert.Equal("Set DOCKER_CERT_PATH or pass --tlskey, --tlscacert", check.Hint)
+
+	tempdir, _ := ioutil.TempDir("", "skeg")
+	defer os.RemoveAll(tempdir)
+
+	os.Setenv("DOCKER_CERT_PATH", tempdir)
+	check = checkDockerTLS()
+	assert.Equal(checkFail, check.Status)
+	assert.Equal("cert "+filepath.Join(tempdir, "cert.pem")+" not found", check.Message)
+
+	for _, name := range []string{"cert.pem", "key.pem", "ca.pem"} {
+		ioutil.WriteFile(filepath.Join(tempdir, name), []byte("cert"), 0600)
+	}
+	check = checkDockerTLS()
+	assert.Equal(checkWarn, check.Status)
+	assert.Equal("using certs in "+tempdir+", --tlscert ignored", check.Message)
+
+	globalOptions.TLSCert = ""
+	assert.Equal(checkPass, checkDockerTLS().Status)
+}
+
+func TestAPIVersionBelow(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(apiVersionBelow("1.22", "1.23"))
+	assert.True(apiVersionBelow("1.9", "1.23"))
+	assert.False(apiVersionBelow("1.23", "1.23"))
+	assert.False(apiVersionBelow("1.30", "1.23"))
+	assert.False(apiVersionBelow("2.0", "1.23"))
+}
+
+func TestDiagnose(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Unsetenv("DOCKER_HOST")
+
+	sc := NewTestSystemClient()
+	dc := NewTestDockerClient()
+
+	statuses := func(checks []Check) map[string]string {
+		result := make(map[string]string)
+		for _, check := range checks {
+			result[check.Name] = check.Status
+		}
+		return result
+	}
+
+	assert.Equal(map[string]string{
+		"ssh":               checkPass,
+		"ssh-keygen":        checkPass,
+		"ssh key":           checkPass,
+		"docker":            checkPass,
+		"legacy containers": checkPass,
+		"image versions":    checkPass,
+	}, statuses(Diagnose(dc, sc)))
+
+	sc.missingCommands = []string{"ssh", "ssh-keygen"}
+	sc.fails.SetFailure("CheckSSHKey", ErrSSHKeyNotCreated)
+	dc.fails.SetFailure("ServerVersion", errors.New("connection refused"))
+	assert.Equal(map[string]string{
+		"ssh":        checkWarn,
+		"ssh-keygen": checkFail,
+		"ssh key":    checkPass,
+		"docker":     checkFail,
+	}, statuses(Diagnose(dc, sc)))
+
+	sc.missingCommands = nil
+	sc.fails.ClearFailures()
+	dc.fails.ClearFailures()
+
+	sc.EnsureEnvironmentDir("foo")
+	sc.EnsureEnvironmentDir("bar")
+	sc.EnsureEnvironmentDir("baz")
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foo",
+			Names:  []string{"/skeg_nate_foo"},
+			Image:  "skeg-nate-old:latest",
+			Status: "Up 1 hour",
+			Ports:  []docker.APIPort{{PrivatePort: 22, PublicPort: 32768, Type: "tcp", IP: "0.0.0.0"}},
+			Labels: map[string]string{"skeg.io/image/username": "nate"},
+		},
+	)
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "bar",
+			Names:  []string{"/skeg_nate_bar"},
+			Image:  "skeg-nate-old:latest",
+			Status: "Up 1 hour",
+			Labels: map[string]string{"skeg.io/image/username": "nate"},
+		},
+	)
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "baz",
+			Names:  []string{"/skeg_baz"},
+			Image:  "skeg-baz:latest",
+			Status: "Exited (0) 1 hour ago",
+		},
+	)
+	dc.images = append(dc.images, docker.APIImages{
+		ID:       "old",
+		RepoTags: []string{"skeg-nate-old:latest"},
+		Labels: map[string]string{
+			"skeg.io/image/username": "nate",
+			"skeg.io/image/version":  "2",
+		},
+	})
+
+	checks := Diagnose(dc, sc)
+	assert.Equal(map[string]string{
+		"ssh":              checkPass,
+		"ssh-keygen":       checkPass,
+		"ssh key":          checkPass,
+		"docker":           checkPass,
+		"legacy container": checkWarn,
+		"image version":    checkWarn,
+		"sshd bar":         checkFail,
+		"sshd foo":         checkPass,
+	}, statuses(checks))
+
+	for _, check := range checks {
+		switch check.Name {
+		case "legacy container":
+			assert.Equal("Run `docker rename skeg_baz skeg_nate_baz` to re-associate it", check.Hint)
+		case "image version":
+			assert.Equal("image skeg-nate-old:latest is version 2, current is 3", check.Message)
+			assert.Equal("Rebuild bar, foo with `skeg rebuild`", check.Hint)
+		case "sshd foo":
+			assert.Equal("answering on localhost:32768", check.Message)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Distro holds the commands used by BuildImage to set up a user image for a
+// family of Linux distributions.
+type Distro struct {
+	Name string
+
+	userSet        func(username string, uid, gid int) string
+	sshdSet        string
+	tzSet          func(tz string) string
+	dockerGroupSet func(username string, gid int) string
+}
+
+var distros = map[string]Distro{
+	"debian": {
+		Name: "debian",
+		userSet: func(username string, uid, gid int) string {
+			return fmt.Sprintf(`(addgroup --gid %d %s || /bin/true) && \
+    adduser --uid %d --gid %d %s --gecos "" --disabled-password`, gid, username, uid, gid, username)
+		},
+		sshdSet: `echo "AuthorizedKeysFile .ssh/authorized_keys .ssh/authorized_keys2 /etc/ssh/keys/%u/authorized_keys" >> /etc/ssh/sshd_config`,
+		tzSet: func(tz string) string {
+			return fmt.Sprintf(`ln -sf /usr/share/zoneinfo/%s /etc/localtime && dpkg-reconfigure --frontend noninteractive tzdata`, tz)
+		},
+		dockerGroupSet: func(username string, gid int) string {
+			return fmt.Sprintf(`(addgroup --gid %d docker-host || /bin/true) && adduser %s $(getent group %d | cut -d: -f1)`, gid, username, gid)
+		},
+	},
+	"alpine": {
+		Name: "alpine",
+		// busybox adduser -D locks the account, which sshd refuses, so
+		// replace the locked password with one that can't be used instead
+		userSet: func(username string, uid, gid int) string {
+			return fmt.Sprintf(`(addgroup -g %d %s || /bin/true) && \
+    adduser -D -u %d -G $(getent group %d | cut -d: -f1) -s /bin/sh %s && \
+    sed -i "s/^%s:!/%s:*/" /etc/shadow`, gid, username, uid, gid, username, username, username)
+		},
+		sshdSet: `echo "AuthorizedKeysFile .ssh/authorized_keys .ssh/authorized_keys2 /etc/ssh/keys/%u/authorized_keys" >> /etc/ssh/sshd_config && \
+    ssh-keygen -A`,
+		tzSet: func(tz string) string {
+			return fmt.Sprintf(`ln -sf /usr/share/zoneinfo/%s /etc/localtime && echo "%s" > /etc/timezone`, tz, tz)
+		},
+		dockerGroupSet: func(username string, gid int) string {
+			return fmt.Sprintf(`(addgroup -g %d docker-host || /bin/true) && addgroup %s $(getent group %d | cut -d: -f1)`, gid, username, gid)
+		},
+	},
+	"fedora": {
+		Name:           "fedora",
+		userSet:        shadowUserSet,
+		sshdSet:        shadowSshdSet,
+		tzSet:          shadowTzSet,
+		dockerGroupSet: shadowDockerGroupSet,
+	},
+	"arch": {
+		Name:           "arch",
+		userSet:        shadowUserSet,
+		sshdSet:        shadowSshdSet,
+		tzSet:          shadowTzSet,
+		dockerGroupSet: shadowDockerGroupSet,
+	},
+}
+
+// distroAliases maps os-release IDs to the distro family that handles them.
+var distroAliases = map[string]string{
+	"debian":    "debian",
+	"ubuntu":    "debian",
+	"alpine":    "alpine",
+	"fedora":    "fedora",
+	"rhel":      "fedora",
+	"centos":    "fedora",
+	"arch":      "arch",
+	"archlinux": "arch",
+}
+
+// the shadow-utils commands are shared by the Fedora/RHEL and Arch families
+
+func shadowUserSet(username string, uid, gid int) string {
+	return fmt.Sprintf(`(groupadd -g %d %s || /bin/true) && \
+    useradd -m -u %d -g %d %s && \
+    usermod -p "*" %s`, gid, username, uid, gid, username, username)
+}
+
+const shadowSshdSet = `echo "AuthorizedKeysFile .ssh/authorized_keys .ssh/authorized_keys2 /etc/ssh/keys/%u/authorized_keys" >> /etc/ssh/sshd_config && \
+    ssh-keygen -A`
+
+func shadowTzSet(tz string) string {
+	return fmt.Sprintf(`ln -sf /usr/share/zoneinfo/%s /etc/localtime`, tz)
+}
+
+func shadowDockerGroupSet(username string, gid int) string {
+	return fmt.Sprintf(`(groupadd -g %d docker-host || /bin/true) && usermod -aG $(getent group %d | cut -d: -f1) %s`, gid, gid, username)
+}
+
+func distroNames() []string {
+	names := make([]string, 0)
+	for name := range distros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// GetDistro looks up a distro family by name, or by the ID of a distribution
+// in the family.
+func GetDistro(name string) (Distro, error) {
+	if family, ok := distroAliases[strings.ToLower(name)]; ok {
+		return distros[family], nil
+	}
+
+	return Distro{}, fmt.Errorf("Unsupported distribution '%s', supported families are: %s", name, strings.Join(distroNames(), ", "))
+}
+
+// DetectDistro figures out the distro family of an image by reading its
+// /etc/os-release, without running the image.
+func DetectDistro(dc DockerClient, image string) (Distro, error) {
+	probeName := fmt.Sprintf("%s-probe-%d", CONT_PREFIX, time.Now().UnixNano())
+	err := dc.CreateContainer(CreateContainerOpts{
+		Name:  probeName,
+		Image: image,
+		Cmd:   []string{"/bin/true"},
+	})
+	if err != nil {
+		return Distro{}, err
+	}
+	defer func() {
+		err := dc.RemoveContainer(probeName)
+		if err != nil {
+			logrus.Warnf("Unable to remove probe container %s: %s", probeName, err)
+		}
+	}()
+
+	// os-release is frequently a symlink, so follow it a few times
+	releasePath := "/etc/os-release"
+	for i := 0; i < 3; i++ {
+		var data bytes.Buffer
+		err = dc.DownloadFromContainer(probeName, releasePath, &data)
+		if err != nil {
+			return Distro{}, fmt.Errorf("Unable to detect distribution of %s (%s), specify one of: %s", image, err, strings.Join(distroNames(), ", "))
+		}
+
+		tr := tar.NewReader(&data)
+		header, err := tr.Next()
+		if err != nil {
+			return Distro{}, err
+		}
+
+		if header.Typeflag == tar.TypeSymlink {
+			if path.IsAbs(header.Linkname) {
+				releasePath = header.Linkname
+			} else {
+				releasePath = path.Join(path.Dir(releasePath), header.Linkname)
+			}
+			continue
+		}
+
+		ids := parseOsRelease(tr)
+		for _, id := range ids {
+			if distro, err := GetDistro(id); err == nil {
+				logrus.Debugf("Detected %s distro for image %s", distro.Name, image)
+				return distro, nil
+			}
+		}
+
+		return Distro{}, fmt.Errorf("Unsupported distribution '%s' in image %s, supported families are: %s", strings.Join(ids, "/"), image, strings.Join(distroNames(), ", "))
+	}
+
+	return Distro{}, fmt.Errorf("Unable to read %s in image %s", releasePath, image)
+}
+
+// parseOsRelease returns the ID followed by any ID_LIKE entries from an
+// os-release file.
+func parseOsRelease(r io.Reader) []string {
+	var id string
+	var like []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		value := strings.Trim(parts[1], `"'`)
+		switch parts[0] {
+		case "ID":
+			id = value
+		case "ID_LIKE":
+			like = strings.Fields(value)
+		}
+	}
+
+	return append([]string{id}, like...)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDistro(t *testing.T) {
+	assert := assert.New(t)
+
+	for name, family := range map[string]string{
+		"debian": "debian",
+		"Ubuntu": "debian",
+		"alpine": "alpine",
+		"centos": "fedora",
+		"rhel":   "fedora",
+		"arch":   "arch",
+	} {
+		distro, err := GetDistro(name)
+		assert.Nil(err)
+		assert.Equal(family, distro.Name)
+	}
+
+	_, err := GetDistro("gentoo")
+	assert.Equal(errors.New("Unsupported distribution 'gentoo', supported families are: alpine, arch, debian, fedora"), err)
+}
+
+func TestParseOsRelease(t *testing.T) {
+	assert := assert.New(t)
+
+	ids := parseOsRelease(strings.NewReader(`NAME="CentOS Linux"
+VERSION="7 (Core)"
+ID="centos"
+ID_LIKE="rhel fedora"
+`))
+	assert.Equal([]string{"centos", "rhel", "fedora"}, ids)
+}
+
+func TestDetectDistro(t *testing.T) {
+	assert := assert.New(t)
+
+	dc := NewTestDockerClient()
+	dc.links["/etc/os-release"] = "../usr/lib/os-release"
+	dc.files["/usr/lib/os-release"] = "ID=linuxmint\nID_LIKE=\"ubuntu debian\"\n"
+
+	distro, err := DetectDistro(dc, "linuxmint:18")
+	assert.Nil(err)
+	assert.Equal("debian", distro.Name)
+
+	dc.files["/usr/lib/os-release"] = "ID=opensuse\nID_LIKE=suse\n"
+	_, err = DetectDistro(dc, "opensuse:42.2")
+	assert.Equal(errors.New("Unsupported distribution 'opensuse/suse' in image opensuse:42.2, supported families are: alpine, arch, debian, fedora"), err)
+}
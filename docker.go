@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -25,28 +26,33 @@ type ConnectOpts struct {
 }
 
 type Port struct {
-	HostIp        string `json:"hostIp"`
-	HostPort      int64  `json:"hostPort"`
-	ContainerPort int64  `json:"containerPort"`
-	Type          string `json:"type"`
+	HostIp        string `json:"hostIp" yaml:"hostIp"`
+	HostPort      int64  `json:"hostPort" yaml:"hostPort"`
+	ContainerPort int64  `json:"containerPort" yaml:"containerPort"`
+	Type          string `json:"type" yaml:"type"`
 }
 
 type Container struct {
-	Name    string              `json:"name"`
-	Image   string              `json:"image"`
-	Running bool                `json:"running"`
-	Ports   []Port              `json:"ports"`
-	Labels  map[string]string   `json:"labels"`
-	Mounts  []map[string]string `json:"mounts"`
+	Name    string              `json:"name" yaml:"name"`
+	Image   string              `json:"image" yaml:"image"`
+	Running bool                `json:"running" yaml:"running"`
+	Ports   []Port              `json:"ports" yaml:"ports"`
+	Labels  map[string]string   `json:"labels" yaml:"labels"`
+	Mounts  []map[string]string `json:"mounts" yaml:"mounts"`
 }
 
 type CreateContainerOpts struct {
-	Name     string
-	Hostname string
-	Ports    []Port
-	Volumes  []string
-	Image    string
-	Labels   map[string]string
+	Name      string
+	Hostname  string
+	Ports     []Port
+	Volumes   []string
+	Image     string
+	Labels    map[string]string
+	Env       []string
+	Cmd       []string
+	Network   string
+	Aliases   []string
+	Resources ResourceLimits
 }
 
 type CreateVolumeOpts struct {
@@ -54,10 +60,29 @@ type CreateVolumeOpts struct {
 	Labels map[string]string
 }
 
+type CreateNetworkOpts struct {
+	Name   string
+	Labels map[string]string
+}
+
+// ExecOpts describes a command run in a container with the Docker exec API.
+// Height and Width set the initial terminal size when Tty is set.
+type ExecOpts struct {
+	Cmd    []string
+	User   string
+	Tty    bool
+	Height int
+	Width  int
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
 type DockerClient interface {
 	ListContainers() ([]docker.APIContainers, error)
 	ListContainersWithLabels(labels []string) ([]docker.APIContainers, error)
 	InspectContainer(cont string) (*docker.Container, error)
+	InspectImage(name string) (*docker.Image, error)
 	ListImages() ([]docker.APIImages, error)
 	ListImagesWithLabels(labels []string) ([]docker.APIImages, error)
 	PullImage(image string, output *os.File) error
@@ -71,6 +96,19 @@ type DockerClient interface {
 	CreateVolume(CreateVolumeOpts) error
 	RemoveVolume(string) error
 	RemoveImage(string) error
+	ListNetworks() ([]docker.Network, error)
+	CreateNetwork(CreateNetworkOpts) error
+	RemoveNetwork(string) error
+	ConnectNetwork(network, container string, aliases []string) error
+	DownloadFromContainer(name, path string, output io.Writer) error
+	UploadToContainer(name, path string, input io.Reader) error
+	ExportImage(name string, output io.Writer) error
+	LoadImage(input io.Reader) error
+	CommitContainer(name, repo, tag string, labels map[string]string) error
+	CreateExec(name string, eo ExecOpts) (string, error)
+	StartExec(id string, eo ExecOpts) error
+	InspectExec(id string) (int, error)
+	ServerVersion() (string, string, error)
 }
 
 type RealDockerClient struct {
@@ -81,6 +119,20 @@ func (rdc *RealDockerClient) InspectContainer(cont string) (*docker.Container, e
 	return rdc.dcl.InspectContainer(cont)
 }
 
+func (rdc *RealDockerClient) InspectImage(name string) (*docker.Image, error) {
+	return rdc.dcl.InspectImage(name)
+}
+
+// ServerVersion returns the version of the docker daemon and of its API.
+func (rdc *RealDockerClient) ServerVersion() (string, string, error) {
+	env, err := rdc.dcl.Version()
+	if err != nil {
+		return "", "", err
+	}
+
+	return env.Get("Version"), env.Get("ApiVersion"), nil
+}
+
 func (rdc *RealDockerClient) StartContainer(name string) error {
 	err := rdc.dcl.StartContainer(name, nil)
 	if err != nil {
@@ -115,7 +167,7 @@ func (rdc *RealDockerClient) CreateContainer(cco CreateContainerOpts) error {
 	for _, port := range cco.Ports {
 		dport := docker.Port(fmt.Sprintf("%d/%s", port.ContainerPort, port.Type))
 		exposedPorts[dport] = struct{}{}
-		portBindings[dport] = []docker.PortBinding{{port.HostIp, fmt.Sprintf("%d", port.HostPort)}}
+		portBindings[dport] = []docker.PortBinding{{HostIP: port.HostIp, HostPort: fmt.Sprintf("%d", port.HostPort)}}
 	}
 
 	config := docker.Config{
@@ -123,13 +175,35 @@ func (rdc *RealDockerClient) CreateContainer(cco CreateContainerOpts) error {
 		Image:        cco.Image,
 		Hostname:     cco.Hostname,
 		Labels:       cco.Labels,
+		Env:          cco.Env,
+		Cmd:          cco.Cmd,
 	}
 	hostConfig := docker.HostConfig{
 		Binds:        cco.Volumes,
 		PortBindings: portBindings,
+		CPUPeriod:    cco.Resources.CPUPeriod,
+		CPUQuota:     cco.Resources.CPUQuota,
+		Memory:       cco.Resources.Memory,
+		MemorySwap:   cco.Resources.MemorySwap,
+		PidsLimit:    cco.Resources.PidsLimit,
+	}
+
+	var networkingConfig *docker.NetworkingConfig
+	if len(cco.Network) > 0 {
+		hostConfig.NetworkMode = cco.Network
+		networkingConfig = &docker.NetworkingConfig{
+			EndpointsConfig: map[string]*docker.EndpointConfig{
+				cco.Network: {Aliases: cco.Aliases},
+			},
+		}
 	}
 
-	_, err := rdc.dcl.CreateContainer(docker.CreateContainerOptions{Name: cco.Name, Config: &config, HostConfig: &hostConfig})
+	_, err := rdc.dcl.CreateContainer(docker.CreateContainerOptions{
+		Name:             cco.Name,
+		Config:           &config,
+		HostConfig:       &hostConfig,
+		NetworkingConfig: networkingConfig,
+	})
 	if err != nil {
 		return err
 	}
@@ -165,6 +239,122 @@ func (rdc *RealDockerClient) RemoveImage(name string) error {
 	return rdc.dcl.RemoveImage(name)
 }
 
+func (rdc *RealDockerClient) ListNetworks() ([]docker.Network, error) {
+	return rdc.dcl.ListNetworks()
+}
+
+func (rdc *RealDockerClient) CreateNetwork(cno CreateNetworkOpts) error {
+	_, err := rdc.dcl.CreateNetwork(docker.CreateNetworkOptions{
+		Name:           cno.Name,
+		Driver:         "bridge",
+		Labels:         cno.Labels,
+		CheckDuplicate: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (rdc *RealDockerClient) RemoveNetwork(name string) error {
+	return rdc.dcl.RemoveNetwork(name)
+}
+
+func (rdc *RealDockerClient) ConnectNetwork(network, container string, aliases []string) error {
+	return rdc.dcl.ConnectNetwork(network, docker.NetworkConnectionOptions{
+		Container:      container,
+		EndpointConfig: &docker.EndpointConfig{Aliases: aliases},
+	})
+}
+
+func (rdc *RealDockerClient) DownloadFromContainer(name, path string, output io.Writer) error {
+	return rdc.dcl.DownloadFromContainer(name, docker.DownloadFromContainerOptions{
+		Path:         path,
+		OutputStream: output,
+	})
+}
+
+func (rdc *RealDockerClient) UploadToContainer(name, path string, input io.Reader) error {
+	return rdc.dcl.UploadToContainer(name, docker.UploadToContainerOptions{
+		Path:        path,
+		InputStream: input,
+	})
+}
+
+func (rdc *RealDockerClient) ExportImage(name string, output io.Writer) error {
+	return rdc.dcl.ExportImage(docker.ExportImageOptions{
+		Name:         name,
+		OutputStream: output,
+	})
+}
+
+func (rdc *RealDockerClient) LoadImage(input io.Reader) error {
+	return rdc.dcl.LoadImage(docker.LoadImageOptions{InputStream: input})
+}
+
+func (rdc *RealDockerClient) CommitContainer(name, repo, tag string, labels map[string]string) error {
+	_, err := rdc.dcl.CommitContainer(docker.CommitContainerOptions{
+		Container:  name,
+		Repository: repo,
+		Tag:        tag,
+		Run:        &docker.Config{Labels: labels},
+	})
+	return err
+}
+
+func (rdc *RealDockerClient) CreateExec(name string, eo ExecOpts) (string, error) {
+	exec, err := rdc.dcl.CreateExec(docker.CreateExecOptions{
+		Container:    name,
+		Cmd:          eo.Cmd,
+		User:         eo.User,
+		Tty:          eo.Tty,
+		AttachStdin:  eo.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return exec.ID, nil
+}
+
+func (rdc *RealDockerClient) StartExec(id string, eo ExecOpts) error {
+	opts := docker.StartExecOptions{
+		InputStream:  eo.Stdin,
+		OutputStream: eo.Stdout,
+		ErrorStream:  eo.Stderr,
+		Tty:          eo.Tty,
+		RawTerminal:  eo.Tty,
+	}
+
+	// the terminal can only be resized once the exec has started
+	if eo.Tty && eo.Height > 0 && eo.Width > 0 {
+		success := make(chan struct{})
+		opts.Success = success
+		go func() {
+			<-success
+			err := rdc.dcl.ResizeExecTTY(id, eo.Height, eo.Width)
+			if err != nil {
+				logrus.Debugf("Unable to resize exec terminal: %s", err)
+			}
+			success <- struct{}{}
+		}()
+	}
+
+	return rdc.dcl.StartExec(id, opts)
+}
+
+func (rdc *RealDockerClient) InspectExec(id string) (int, error) {
+	exec, err := rdc.dcl.InspectExec(id)
+	if err != nil {
+		return 0, err
+	}
+
+	return exec.ExitCode, nil
+}
+
 func (rdc *RealDockerClient) BuildImage(name string, dockerfile, sshkey string, output io.Writer) error {
 
 	t := time.Now()
@@ -279,9 +469,7 @@ func NewDockerClient(opts ConnectOpts) (*RealDockerClient, error) {
 	return &dockerClient, nil
 }
 
-func connectDocker() (*docker.Client, error) {
-
-	// grab directly from docker daemon
+func dockerEndpoint() string {
 	var endpoint string
 	if env_endpoint := os.Getenv("DOCKER_HOST"); len(env_endpoint) > 0 {
 		endpoint = env_endpoint
@@ -297,6 +485,30 @@ func connectDocker() (*docker.Client, error) {
 		}
 	}
 
+	return endpoint
+}
+
+// dockerEndpointIsLocal reports whether the docker daemon is reached through a
+// socket on this machine.
+func dockerEndpointIsLocal() bool {
+	return strings.HasPrefix(dockerEndpoint(), "unix://")
+}
+
+// dockerSocketPath returns the path of the docker socket on the docker host,
+// for mounting into containers.
+func dockerSocketPath() string {
+	if endpoint := dockerEndpoint(); strings.HasPrefix(endpoint, "unix://") {
+		return strings.TrimPrefix(endpoint, "unix://")
+	}
+
+	return "/var/run/docker.sock"
+}
+
+func connectDocker() (*docker.Client, error) {
+
+	// grab directly from docker daemon
+	endpoint := dockerEndpoint()
+
 	var client *docker.Client
 	var err error
 	dockerTlsVerifyEnv := os.Getenv("DOCKER_TLS_VERIFY")
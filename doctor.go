@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type DoctorCommand struct{}
+
+var doctorCommand DoctorCommand
+
+func (x *DoctorCommand) Execute(args []string) error {
+	checks := checkUserEnv()
+	userEnvSet := checks[0].Status == checkPass && checks[1].Status == checkPass
+	checks = append(checks, checkDockerTLS())
+
+	// without the user's name and home there's no skeg dir to check
+	if userEnvSet {
+		checks = append(checks, runDoctor()...)
+	}
+
+	failed := 0
+	items := make([]interface{}, 0)
+	table := Table{Headers: []string{"STATUS", "CHECK", "MESSAGE"}}
+	for _, check := range checks {
+		if check.Status == checkFail {
+			failed++
+		}
+		items = append(items, check)
+		table.Rows = append(table.Rows, []string{check.Status, check.Name, check.Message})
+	}
+
+	format := outputFormat("")
+	if len(format) > 0 {
+		err := printOutput(os.Stdout, format, checks, items, table)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, check := range checks {
+			fmt.Printf("[%s] %s: %s\n", check.Status, check.Name, check.Message)
+			if len(check.Hint) > 0 && check.Status != checkPass {
+				fmt.Printf("       %s\n", check.Hint)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+
+	return nil
+}
+
+// runDoctor creates the clients and runs the checks needing them, reporting
+// the clients that can't be created.
+func runDoctor() []Check {
+	checks := make([]Check, 0)
+
+	// the rest is checked with the default settings when the config is broken
+	cfg, err := loadConfig()
+	if err != nil {
+		checks = append(checks, Check{
+			Name:    "config",
+			Status:  checkFail,
+			Message: err.Error(),
+			Hint:    "Fix the error in the config file",
+		})
+		cfg = Config{}
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return append(checks, Check{Name: "skeg dir", Status: checkFail, Message: err.Error()})
+	}
+
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return append(append(checks, checkSSH(sc)...), Check{
+			Name:    "docker",
+			Status:  checkFail,
+			Message: err.Error(),
+			Hint:    "Check the docker tls settings",
+		})
+	}
+
+	return append(checks, Diagnose(dc, sc)...)
+}
+
+func init() {
+	_, err := parser.AddCommand("doctor",
+		"Check skeg's setup.",
+		"Runs checks on docker, ssh and environments, printing hints to fix what fails.",
+		&doctorCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// envBlockStart and envBlockEnd mark the variables skeg adds to
+// /etc/environment, so they can be replaced.
+const envBlockStart = "# added by skeg"
+const envBlockEnd = "# end of skeg variables"
+
+// ParseEnv turns -e options and env files into a list of KEY=VAL variables.
+// Like docker, a variable given without a value is taken from the host's
+// environment, and skipped if it isn't set there.  Env files have a
+// variable per line, blank lines and lines starting with # are ignored.
+func ParseEnv(vars, files []string) ([]string, error) {
+	env := make([]string, 0)
+
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			return env, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if len(line) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			v, ok, err := parseEnvVar(line)
+			if err != nil {
+				file.Close()
+				return env, fmt.Errorf("%s line %d: %s", path, n, err)
+			}
+			if ok {
+				env = append(env, v)
+			}
+		}
+		file.Close()
+
+		if err = scanner.Err(); err != nil {
+			return env, err
+		}
+	}
+
+	for _, v := range vars {
+		v, ok, err := parseEnvVar(v)
+		if err != nil {
+			return env, err
+		}
+		if ok {
+			env = append(env, v)
+		}
+	}
+
+	return mergeEnv(env), nil
+}
+
+func parseEnvVar(v string) (string, bool, error) {
+	parts := strings.SplitN(v, "=", 2)
+	key := parts[0]
+	if len(key) == 0 || strings.ContainsAny(key, " \t") {
+		return "", false, fmt.Errorf("Invalid environment variable '%s'", v)
+	}
+
+	if len(parts) == 1 {
+		val, ok := os.LookupEnv(key)
+		if !ok {
+			logrus.Debugf("Skipping %s, it isn't set", key)
+			return "", false, nil
+		}
+		parts = append(parts, val)
+	}
+
+	err := checkEnvValue(key, parts[1])
+	if err != nil {
+		return "", false, err
+	}
+
+	return fmt.Sprintf("%s=%s", key, parts[1]), true, nil
+}
+
+// checkEnvValue rejects values that can't be written to the files ssh
+// sessions read the variables from, which have a variable per line.
+func checkEnvValue(key, val string) error {
+	if strings.ContainsAny(val, "\r\n") {
+		return fmt.Errorf("Environment variable %s can't contain a newline", key)
+	}
+
+	return nil
+}
+
+// mergeEnv combines lists of KEY=VAL variables, later values of a key
+// replacing earlier ones in place.
+func mergeEnv(lists ...[]string) []string {
+	merged := make([]string, 0)
+	index := make(map[string]int)
+
+	for _, list := range lists {
+		for _, v := range list {
+			key := strings.SplitN(v, "=", 2)[0]
+			if i, ok := index[key]; ok {
+				merged[i] = v
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, v)
+		}
+	}
+
+	return merged
+}
+
+// addEnvLabel records an environment's variables in its container's labels,
+// so they're kept when it's rebuilt.
+func addEnvLabel(labels map[string]string, env []string) error {
+	if len(env) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	labels["skeg.io/container/env"] = string(data)
+
+	return nil
+}
+
+// envFromLabels reads the variables an environment's container was created
+// with.
+func envFromLabels(labels map[string]string) []string {
+	env := make([]string, 0)
+	if data, ok := labels["skeg.io/container/env"]; ok {
+		err := json.Unmarshal([]byte(data), &env)
+		if err != nil {
+			logrus.Warnf("Ignoring invalid environment label: %s", err)
+		}
+	}
+
+	return env
+}
+
+// installEnv makes an environment's variables visible to ssh sessions,
+// which don't inherit the container's environment.  pam_env reads them from
+// /etc/environment, and login shells without PAM source them from
+// /etc/profile.d/skeg_env.sh.
+func installEnv(dc DockerClient, containerName string, env []string) error {
+	var current string
+	var download bytes.Buffer
+	err := dc.DownloadFromContainer(containerName, "/etc/environment", &download)
+	if err != nil {
+		logrus.Debugf("No /etc/environment found: %s", err)
+	} else {
+		tr := tar.NewReader(&download)
+		if _, err := tr.Next(); err == nil {
+			data, _ := ioutil.ReadAll(tr)
+			current = string(data)
+		}
+	}
+
+	etcEnvironment, profile := envFiles(current, env)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err = tw.WriteHeader(&tar.Header{Name: "profile.d/", Mode: 0755, Typeflag: tar.TypeDir})
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		name string
+		data string
+	}{
+		{"environment", etcEnvironment},
+		{"profile.d/skeg_env.sh", profile},
+	}
+	for _, file := range files {
+		err = tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data)), Typeflag: tar.TypeReg})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write([]byte(file.data))
+		if err != nil {
+			return err
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+
+	return dc.UploadToContainer(containerName, "/etc", &buf)
+}
+
+// envFiles returns the contents of /etc/environment, replacing variables
+// previously added by skeg in current, and of the profile script exporting
+// the variables.
+func envFiles(current string, env []string) (string, string) {
+	lines := make([]string, 0)
+	skipping := false
+	for _, line := range strings.Split(strings.TrimRight(current, "\n"), "\n") {
+		switch {
+		case line == envBlockStart:
+			skipping = true
+		case line == envBlockEnd:
+			skipping = false
+		case !skipping && len(line) > 0:
+			lines = append(lines, line)
+		}
+	}
+
+	exports := []string{envBlockStart}
+	lines = append(lines, envBlockStart)
+	for _, v := range env {
+		parts := strings.SplitN(v, "=", 2)
+		// pam_env reads values quoted, with no way to escape a quote or
+		// backslash, so those are only exported by the profile script
+		if strings.ContainsAny(parts[1], `"\`) {
+			logrus.Warnf(`Leaving %s out of /etc/environment, which can't hold " or \, it's only set for login shells`, parts[0])
+		} else {
+			lines = append(lines, fmt.Sprintf(`%s="%s"`, parts[0], parts[1]))
+		}
+		exports = append(exports, fmt.Sprintf("export %s='%s'", parts[0], strings.Replace(parts[1], "'", `'\''`, -1)))
+	}
+	lines = append(lines, envBlockEnd)
+
+	return strings.Join(lines, "\n") + "\n", strings.Join(exports, "\n") + "\n"
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "skeg")
+	defer os.RemoveAll(tempdir)
+
+	envFile := filepath.Join(tempdir, "env")
+	ioutil.WriteFile(envFile, []byte("# settings\nFOO=bar\n\nBAZ=a=b\nSKEG_TEST_HOST\nSKEG_TEST_UNSET\n"), 0644)
+	os.Setenv("SKEG_TEST_HOST", "host value")
+	defer os.Unsetenv("SKEG_TEST_HOST")
+
+	env, err := ParseEnv([]string{"FOO=override", "QUX="}, []string{envFile})
+	assert.Nil(err)
+	assert.Equal([]string{"FOO=override", "BAZ=a=b", "SKEG_TEST_HOST=host value", "QUX="}, env)
+
+	_, err = ParseEnv([]string{"=bar"}, nil)
+	assert.Equal(errors.New("Invalid environment variable '=bar'"), err)
+
+	env, err = ParseEnv([]string{`MSG={"say": "hi"}`, `DIR=C:\Users`}, nil)
+	assert.Nil(err)
+	assert.Equal([]string{`MSG={"say": "hi"}`, `DIR=C:\Users`}, env)
+
+	os.Setenv("SKEG_TEST_MULTILINE", "a\nb")
+	defer os.Unsetenv("SKEG_TEST_MULTILINE")
+	_, err = ParseEnv([]string{"SKEG_TEST_MULTILINE"}, nil)
+	assert.Equal(errors.New("Environment variable SKEG_TEST_MULTILINE can't contain a newline"), err)
+
+	ioutil.WriteFile(envFile, []byte("FOO=bar\nBAD KEY=1\n"), 0644)
+	_, err = ParseEnv(nil, []string{envFile})
+	assert.Equal(errors.New(envFile+" line 2: Invalid environment variable 'BAD KEY=1'"), err)
+
+	_, err = ParseEnv(nil, []string{filepath.Join(tempdir, "missing")})
+	assert.NotNil(err)
+}
+
+func TestEnvLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	labels := make(map[string]string)
+	assert.Nil(addEnvLabel(labels, []string{}))
+	assert.Empty(labels)
+	assert.Equal([]string{}, envFromLabels(labels))
+
+	assert.Nil(addEnvLabel(labels, []string{"FOO=bar", "LIST=a,b"}))
+	assert.Equal([]string{"FOO=bar", "LIST=a,b"}, envFromLabels(labels))
+
+	// variables given on rebuild replace the old ones
+	assert.Equal([]string{"FOO=new", "LIST=a,b", "BAZ=1"}, mergeEnv(envFromLabels(labels), []string{"FOO=new", "BAZ=1"}))
+}
+
+func TestInstallEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	dc := NewTestDockerClient()
+	dc.files["/etc/environment"] = "PATH=\"/usr/bin:/bin\"\n# added by skeg\nOLD=\"1\"\n# end of skeg variables\n"
+
+	err := installEnv(dc, "skeg_nate_foo", []string{"FOO=bar", "QUOTE=it's", `JSON={"a": 1}`})
+	assert.Nil(err)
+	assert.Equal("PATH=\"/usr/bin:/bin\"\n# added by skeg\nFOO=\"bar\"\nQUOTE=\"it's\"\n# end of skeg variables\n", dc.files["/etc/environment"])
+	assert.Equal("# added by skeg\nexport FOO='bar'\nexport QUOTE='it'\\''s'\nexport JSON='{\"a\": 1}'\n", dc.files["/etc/profile.d/skeg_env.sh"])
+
+	// images without /etc/environment get one
+	delete(dc.files, "/etc/environment")
+	err = installEnv(dc, "skeg_nate_foo", []string{"FOO=bar"})
+	assert.Nil(err)
+	assert.Equal("# added by skeg\nFOO=\"bar\"\n# end of skeg variables\n", dc.files["/etc/environment"])
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/pkg/term"
+)
+
+type ExecCommand struct {
+	Tty     bool   `short:"t" long:"tty" description:"Allocate a pseudo-TTY."`
+	Workdir string `short:"w" long:"workdir" description:"Directory to run the command in (defaults to home directory)."`
+	Args    struct {
+		Name    string   `description:"Name of environment."`
+		Command []string `description:"Command to run."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var execCommand ExecCommand
+
+func (x *ExecCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	eo := ExecOpts{
+		Cmd:    append(execCommand.Args.Command, args...),
+		Tty:    execCommand.Tty,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+
+	code, err := execWithTerminal(dc, sc, eo)
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		os.Exit(code)
+	}
+
+	return nil
+}
+
+// execWithTerminal puts the local terminal in raw mode for the duration of
+// the command, if a tty was requested.
+func execWithTerminal(dc DockerClient, sc SystemClient, eo ExecOpts) (int, error) {
+	if eo.Tty {
+		inFd, isTerminal := term.GetFdInfo(os.Stdin)
+		if isTerminal {
+			state, err := term.SetRawTerminal(inFd)
+			if err != nil {
+				return 0, err
+			}
+			defer term.RestoreTerminal(inFd, state)
+		}
+
+		outFd, _ := term.GetFdInfo(os.Stdout)
+		if ws, err := term.GetWinsize(outFd); err == nil {
+			eo.Height = int(ws.Height)
+			eo.Width = int(ws.Width)
+		}
+	}
+
+	return ExecEnvironment(dc, sc, execCommand.Args.Name, execCommand.Workdir, eo)
+}
+
+func init() {
+	_, err := parser.AddCommand("exec",
+		"Run a command in an environment.",
+		"Run a command in an environment with the Docker exec API, without ssh.  The command's exit code is returned.",
+		&execCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
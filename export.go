@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type ExportCommand struct {
+	Output       string `short:"o" long:"output" description:"Archive file to write (defaults to <name>.skeg.tar.gz)."`
+	IncludeImage bool   `long:"include-image" description:"Include the user image in the archive."`
+	Args         struct {
+		Name string `description:"Name of environment."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var exportCommand ExportCommand
+
+func (x *ExportCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	output := exportCommand.Output
+	if len(output) == 0 {
+		output = fmt.Sprintf("%s.skeg.tar.gz", exportCommand.Args.Name)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	err = ExportEnvironment(dc, sc, exportCommand.Args.Name, file, exportCommand.IncludeImage)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+		return err
+	}
+
+	fmt.Printf("Environment exported to %s\n", output)
+
+	return nil
+}
+
+func init() {
+	_, err := parser.AddCommand("export",
+		"Export an environment.",
+		"Write an environment's settings and home directory to an archive that can be imported on another machine or Docker host.",
+		&exportCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Forward is a host port forwarded to a running environment over ssh, added
+// after the container was created.
+type Forward struct {
+	Env           string `json:"env"`
+	HostIp        string `json:"hostIp"`
+	HostPort      int64  `json:"hostPort"`
+	ContainerPort int64  `json:"containerPort"`
+	Pid           int    `json:"pid"`
+}
+
+// EnvPort is a port reachable on an environment, either published by docker
+// or forwarded by skeg.
+type EnvPort struct {
+	Port    `yaml:",inline"`
+	Source  string `json:"source" yaml:"source"`
+	Running bool   `json:"running" yaml:"running"`
+}
+
+// AddForward forwards a host port to a running environment, given a port spec
+// like "8080:80", without recreating the container.
+func AddForward(dc DockerClient, sc SystemClient, name, spec string) (Forward, error) {
+	ports, err := ParsePorts([]string{spec})
+	if err != nil {
+		return Forward{}, err
+	}
+
+	if len(ports) != 1 {
+		return Forward{}, fmt.Errorf("Invalid port %s", spec)
+	}
+	port := ports[0]
+
+	if port.HostPort == 0 {
+		return Forward{}, fmt.Errorf("Host port required for %s", spec)
+	}
+	if port.Type != "tcp" {
+		return Forward{}, errors.New("Only tcp ports can be forwarded")
+	}
+
+	// forwards run in the background after skeg exits, which the built in
+	// ssh client can't do
+	if !sc.CommandAvailable("ssh") {
+		return Forward{}, fmt.Errorf("Port forwards need OpenSSH, install it or publish the port with `skeg rebuild %s -p %s`", name, spec)
+	}
+
+	env, err := EnsureRunning(dc, sc, name)
+	if err != nil {
+		return Forward{}, err
+	}
+
+	if env.Container == nil {
+		return Forward{}, errors.New("No container found")
+	}
+
+	inUse, err := portsInUse(dc, sc)
+	if err != nil {
+		return Forward{}, err
+	}
+	if envName, ok := inUse[port.HostPort]; ok {
+		return Forward{}, fmt.Errorf("Host port %d already used by %s", port.HostPort, envName)
+	}
+
+	opts, err := sshOptions(sc, env)
+	if err != nil {
+		return Forward{}, err
+	}
+
+	forward := Forward{
+		Env:           name,
+		HostIp:        port.HostIp,
+		HostPort:      port.HostPort,
+		ContainerPort: port.ContainerPort,
+	}
+	opts = append(opts,
+		"-N",
+		"-o", "ExitOnForwardFailure yes",
+		"-L", forwardSpec(forward),
+	)
+
+	logrus.Debugf("Starting ssh forward %v", opts)
+	forward.Pid, err = sc.StartSSH("ssh", opts)
+	if err != nil {
+		return Forward{}, err
+	}
+
+	forwards, err := sc.Forwards()
+	if err != nil {
+		return forward, err
+	}
+
+	return forward, sc.SaveForwards(append(forwards, forward))
+}
+
+// RemoveForward stops a forward added with AddForward, given its host port or
+// the port spec it was added with.
+func RemoveForward(sc SystemClient, name, spec string) error {
+	var hostPort int64
+	if strings.Contains(spec, ":") {
+		ports, err := ParsePorts([]string{spec})
+		if err != nil {
+			return err
+		}
+		if len(ports) == 1 {
+			hostPort = ports[0].HostPort
+		}
+	} else {
+		hp, err := strconv.Atoi(spec)
+		if err != nil {
+			return fmt.Errorf("Invalid port %s", spec)
+		}
+		hostPort = int64(hp)
+	}
+
+	forwards, err := sc.Forwards()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	remaining := make([]Forward, 0)
+	for _, forward := range forwards {
+		if forward.Env == name && forward.HostPort == hostPort {
+			found = true
+			err = stopForward(sc, forward)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		remaining = append(remaining, forward)
+	}
+
+	if !found {
+		return fmt.Errorf("No forward for port %s on %s", spec, name)
+	}
+
+	return sc.SaveForwards(remaining)
+}
+
+// RemoveForwards stops all forwards added to an environment.
+func RemoveForwards(sc SystemClient, name string) error {
+	forwards, err := sc.Forwards()
+	if err != nil {
+		return err
+	}
+
+	remaining := make([]Forward, 0)
+	for _, forward := range forwards {
+		if forward.Env == name {
+			err = stopForward(sc, forward)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		remaining = append(remaining, forward)
+	}
+
+	if len(remaining) == len(forwards) {
+		return nil
+	}
+
+	return sc.SaveForwards(remaining)
+}
+
+// EnvironmentPorts lists the ports published by docker and forwarded by skeg
+// for an environment.
+func EnvironmentPorts(dc DockerClient, sc SystemClient, name string) ([]EnvPort, error) {
+	ports := make([]EnvPort, 0)
+
+	env, err := GetEnvironment(dc, sc, name)
+	if err != nil {
+		return ports, err
+	}
+
+	if env.Container != nil {
+		for _, port := range env.Container.Ports {
+			ports = append(ports, EnvPort{port, "docker", env.Container.Running})
+		}
+	}
+
+	forwards, err := sc.Forwards()
+	if err != nil {
+		return ports, err
+	}
+
+	for _, forward := range forwards {
+		if forward.Env != name {
+			continue
+		}
+
+		ports = append(ports, EnvPort{
+			Port{forward.HostIp, forward.HostPort, forward.ContainerPort, "tcp"},
+			"skeg",
+			sc.ForwardRunning(forward),
+		})
+	}
+
+	return ports, nil
+}
+
+// forwardSpec is the ssh -L option of a forward.
+func forwardSpec(forward Forward) string {
+	bind := forward.HostIp
+	if len(bind) == 0 {
+		bind = "localhost"
+	}
+
+	return fmt.Sprintf("%s:%d:localhost:%d", bind, forward.HostPort, forward.ContainerPort)
+}
+
+// isForwardProcess reports whether a process with the command line args is
+// the ssh process of a forward.  On windows only the program is known.
+func isForwardProcess(args []string, forward Forward) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	program := args[0][strings.LastIndexAny(args[0], `/\`)+1:]
+	program = strings.TrimSuffix(strings.ToLower(program), ".exe")
+	if program != "ssh" {
+		return false
+	}
+	if len(args) == 1 {
+		return true
+	}
+
+	spec := forwardSpec(forward)
+	for i, arg := range args {
+		if arg == "-L"+spec || (arg == "-L" && i+1 < len(args) && args[i+1] == spec) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stopForward stops a forward's ssh process, if it's still running.
+func stopForward(sc SystemClient, forward Forward) error {
+	if !sc.ForwardRunning(forward) {
+		return nil
+	}
+
+	logrus.Debugf("Stopping forward of port %d (pid %d)", forward.HostPort, forward.Pid)
+	return sc.StopProcess(forward.Pid)
+}
+
+// portsInUse maps host ports published by docker or forwarded by skeg to the
+// environment using them.
+func portsInUse(dc DockerClient, sc SystemClient) (map[int64]string, error) {
+	inUse := make(map[int64]string)
+
+	envs, err := Environments(dc, sc)
+	if err != nil {
+		return inUse, err
+	}
+
+	for name, env := range envs {
+		if env.Container == nil {
+			continue
+		}
+		for _, port := range env.Container.Ports {
+			inUse[port.HostPort] = name
+		}
+	}
+
+	forwards, err := sc.Forwards()
+	if err != nil {
+		return inUse, err
+	}
+
+	for _, forward := range forwards {
+		if sc.ForwardRunning(forward) {
+			inUse[forward.HostPort] = forward.Env
+		}
+	}
+
+	return inUse, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardPorts(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Unsetenv("DOCKER_HOST")
+	sc := NewTestSystemClient()
+
+	dc := NewTestDockerClient()
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foo",
+			Names:  []string{"/skeg_nate_foo"},
+			Image:  "skeg-nate-1234",
+			Status: "Up 12 hours",
+			Ports: []docker.APIPort{
+				{PrivatePort: 22, PublicPort: 32768, Type: "tcp", IP: "0.0.0.0"},
+				{PrivatePort: 3000, PublicPort: 3000, Type: "tcp", IP: "0.0.0.0"},
+			},
+		},
+	)
+	sc.EnsureEnvironmentDir("foo")
+
+	_, err := AddForward(dc, sc, "foo", "80")
+	assert.Equal(errors.New("Host port required for 80"), err)
+
+	_, err = AddForward(dc, sc, "foo", "53:53/udp")
+	assert.Equal(errors.New("Only tcp ports can be forwarded"), err)
+
+	_, err = AddForward(dc, sc, "foo", "3000:80")
+	assert.Equal(errors.New("Host port 3000 already used by foo"), err)
+
+	sc.missingCommands = []string{"ssh"}
+	_, err = AddForward(dc, sc, "foo", "8080:80")
+	assert.Equal(errors.New("Port forwards need OpenSSH, install it or publish the port with `skeg rebuild foo -p 8080:80`"), err)
+	sc.missingCommands = nil
+
+	forward, err := AddForward(dc, sc, "foo", "8080:80")
+	assert.Nil(err)
+	assert.Equal(Forward{Env: "foo", HostPort: 8080, ContainerPort: 80, Pid: 1001}, forward)
+	assert.Equal([]string{
+		"localhost",
+		"-l", "nate",
+		"-p", "32768",
+		"-i", "",
+		"-o", "UserKnownHostsFile /dev/null",
+		"-o", "StrictHostKeyChecking no",
+		"-N",
+		"-o", "ExitOnForwardFailure yes",
+		"-L", "localhost:8080:localhost:80",
+	}, sc.sshArgs[0])
+
+	_, err = AddForward(dc, sc, "foo", "8080:81")
+	assert.Equal(errors.New("Host port 8080 already used by foo"), err)
+
+	_, err = AddForward(dc, sc, "foo", "127.0.0.1:9090:90")
+	assert.Nil(err)
+	assert.Equal("127.0.0.1:9090:localhost:90", sc.sshArgs[1][len(sc.sshArgs[1])-1])
+
+	ports, err := EnvironmentPorts(dc, sc, "foo")
+	assert.Nil(err)
+	assert.Equal([]EnvPort{
+		{Port{"0.0.0.0", 32768, 22, "tcp"}, "docker", true},
+		{Port{"0.0.0.0", 3000, 3000, "tcp"}, "docker", true},
+		{Port{"", 8080, 80, "tcp"}, "skeg", true},
+		{Port{"127.0.0.1", 9090, 90, "tcp"}, "skeg", true},
+	}, ports)
+
+	err = RemoveForward(sc, "foo", "7070")
+	assert.Equal(errors.New("No forward for port 7070 on foo"), err)
+
+	err = RemoveForward(sc, "foo", "8080:80")
+	assert.Nil(err)
+	assert.Equal([]int{1001}, sc.stopped)
+	assert.Len(sc.forwards, 1)
+
+	err = RemoveForwards(sc, "foo")
+	assert.Nil(err)
+	assert.Equal([]int{1001, 1002}, sc.stopped)
+	assert.Len(sc.forwards, 0)
+
+	// stopping an environment, which rebuild, rename and destroy do too,
+	// ends its forwards
+	_, err = AddForward(dc, sc, "foo", "8080:80")
+	assert.Nil(err)
+	_, err = EnsureStopped(dc, sc, "foo")
+	assert.Nil(err)
+	assert.Equal([]int{1001, 1002, 1003}, sc.stopped)
+	assert.Len(sc.forwards, 0)
+}
+
+func TestIsForwardProcess(t *testing.T) {
+	assert := assert.New(t)
+
+	forward := Forward{Env: "foo", HostPort: 8080, ContainerPort: 80, Pid: 1001}
+
+	assert.True(isForwardProcess([]string{"ssh", "-p", "32768", "-N", "-L", "localhost:8080:localhost:80"}, forward))
+	assert.True(isForwardProcess([]string{"/usr/bin/ssh", "-Llocalhost:8080:localhost:80"}, forward))
+	assert.True(isForwardProcess([]string{`C:\Windows\System32\OpenSSH\ssh.exe`}, forward))
+	assert.False(isForwardProcess([]string{"ssh", "-N", "-L", "localhost:9090:localhost:80"}, forward))
+	assert.False(isForwardProcess([]string{"vim", "-L", "localhost:8080:localhost:80"}, forward))
+	assert.False(isForwardProcess([]string{}, forward))
+
+	forward.HostIp = "127.0.0.1"
+	assert.True(isForwardProcess([]string{"ssh", "-L", "127.0.0.1:8080:localhost:80"}, forward))
+}
@@ -5,7 +5,9 @@ import (
 )
 
 type FreezeCommand struct {
-	Args struct {
+	Output       string `short:"o" long:"output" description:"Archive file to write (defaults to <name>.skeg.tar.gz)."`
+	IncludeImage bool   `long:"include-image" description:"Include the user image in the archive."`
+	Args         struct {
 		Name string `description:"Name of environment."`
 	} `positional-args:"yes" required:"yes"`
 }
@@ -18,18 +20,28 @@ func (x *FreezeCommand) Execute(args []string) error {
 		return err
 	}
 
-	sc, err := NewSystemClient()
+	cfg, err := loadConfig()
 	if err != nil {
 		return err
 	}
 
-	return FreezeEnvironment(dc, sc, freezeCommand.Args.Name)
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	output := freezeCommand.Output
+	if len(output) == 0 {
+		output = fmt.Sprintf("%s.skeg.tar.gz", freezeCommand.Args.Name)
+	}
+
+	return FreezeEnvironment(dc, sc, freezeCommand.Args.Name, output, freezeCommand.IncludeImage)
 }
 
 func init() {
 	_, err := parser.AddCommand("freeze",
 		"Freeze an environment.",
-		"",
+		"Archive an environment to a file and remove it.  Use thaw to bring it back.",
 		&freezeCommand)
 
 	if err != nil {
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Garbage is a skeg resource of the user's that no environment uses anymore.
+// Size is the disk space it takes, when docker reports it.
+type Garbage struct {
+	Kind    string `json:"kind" yaml:"kind"`
+	Name    string `json:"name" yaml:"name"`
+	Reason  string `json:"reason" yaml:"reason"`
+	Size    int64  `json:"size" yaml:"size"`
+	Running bool   `json:"-" yaml:"-"`
+}
+
+// FindGarbage looks for the user's containers, volumes, user images and
+// snapshots that don't belong to an environment, and for empty environment
+// directories.  Environments are found through their directories, so
+// anything left behind when a directory was removed isn't listed by skeg
+// otherwise.  Volumes created before volumes were labelled with their owner
+// are never listed.
+func FindGarbage(dc DockerClient, sc SystemClient) ([]Garbage, error) {
+	garbage := make([]Garbage, 0)
+	prefix := fmt.Sprintf("%s_%s_", CONT_PREFIX, sc.Username())
+
+	dirs, err := sc.EnvironmentDirs()
+	if err != nil {
+		return garbage, err
+	}
+
+	containers, err := dc.ListContainers()
+	if err != nil {
+		return garbage, err
+	}
+
+	volumes, err := dc.ListVolumes()
+	if err != nil {
+		return garbage, err
+	}
+
+	withContainer := make(map[string]bool)
+	for _, cont := range containers {
+		name := strings.TrimPrefix(cont.Names[0], "/")
+		if strings.HasPrefix(name, prefix) {
+			withContainer[strings.TrimPrefix(name, prefix)] = true
+		}
+	}
+	volumeNames := make(map[string]bool)
+	for _, vol := range volumes {
+		volumeNames[vol.Name] = true
+	}
+
+	// a directory without a container can still hold a home directory, in
+	// it or in a volume, so only empty ones go
+	liveEnvs := make(map[string]bool)
+	for _, dir := range dirs {
+		if !withContainer[dir] && !volumeNames[prefix+dir] {
+			empty, err := sc.EnvironmentDirEmpty(dir)
+			if err != nil {
+				return garbage, err
+			}
+			if empty {
+				garbage = append(garbage, Garbage{Kind: "directory", Name: dir, Reason: "empty, no container"})
+				continue
+			}
+		}
+		liveEnvs[dir] = true
+	}
+
+	orphaned := make(map[string]bool)
+	for _, cont := range containers {
+		name := strings.TrimPrefix(cont.Names[0], "/")
+		running := strings.Contains(cont.Status, "Up")
+
+		if envName, ok := cont.Labels["skeg.io/service/env"]; ok {
+			if cont.Labels["skeg.io/service/user"] == sc.Username() && !liveEnvs[envName] {
+				orphaned["/"+name] = true
+				garbage = append(garbage, Garbage{Kind: "container", Name: name, Reason: fmt.Sprintf("service of missing environment %s", envName), Running: running})
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if username, ok := cont.Labels["skeg.io/image/username"]; ok && username != sc.Username() {
+			continue
+		}
+
+		envName := strings.TrimPrefix(name, prefix)
+		if !liveEnvs[envName] {
+			orphaned["/"+name] = true
+			garbage = append(garbage, Garbage{Kind: "container", Name: name, Reason: fmt.Sprintf("environment %s has no directory", envName), Running: running})
+		}
+	}
+
+	// names can't tell users apart when one username is a prefix of another,
+	// so only volumes labelled with their owner are considered
+	for _, vol := range volumes {
+		if vol.Labels["skeg.io/volume/user"] != sc.Username() {
+			continue
+		}
+
+		envName := vol.Labels["skeg.io/volume/env"]
+		if !liveEnvs[envName] {
+			garbage = append(garbage, Garbage{Kind: "volume", Name: vol.Name, Reason: fmt.Sprintf("environment %s has no directory", envName)})
+		}
+	}
+
+	images, err := dc.ListImagesWithLabels([]string{fmt.Sprintf("skeg.io/image/username=%s", sc.Username())})
+	if err != nil {
+		return garbage, err
+	}
+
+	sizes := make(map[string]int64)
+	for _, im := range images {
+		if im.Labels["skeg.io/image/username"] != sc.Username() {
+			continue
+		}
+
+		for _, tag := range im.RepoTags {
+			sizes[tag] = im.Size
+		}
+
+		envName, ok := im.Labels["skeg.io/snapshot/env"]
+		if !ok {
+			continue
+		}
+
+		// a snapshot taken again under the same name leaves the old image
+		// dangling
+		if len(im.RepoTags) == 0 || im.RepoTags[0] == "<none>:<none>" {
+			garbage = append(garbage, Garbage{Kind: "snapshot", Name: im.ID, Reason: "untagged", Size: im.Size})
+		} else if !liveEnvs[envName] {
+			garbage = append(garbage, Garbage{Kind: "snapshot", Name: im.RepoTags[0], Reason: fmt.Sprintf("environment %s has no directory", envName), Size: im.Size})
+		}
+	}
+
+	userImages, err := UserImages(dc, sc, ImageOpts{}, -1)
+	if err != nil {
+		return garbage, err
+	}
+
+	for _, im := range userImages {
+		used := false
+		for _, cont := range im.EnvList {
+			if !orphaned[cont] {
+				used = true
+			}
+		}
+
+		if !used {
+			garbage = append(garbage, Garbage{Kind: "image", Name: im.Name, Reason: "not used by an environment", Size: sizes[im.Name]})
+		}
+	}
+
+	sort.Stable(garbageByRemovalOrder(garbage))
+
+	return garbage, nil
+}
+
+// garbageKinds are the kinds of garbage, in the order they can be removed:
+// containers hold on to their images and volumes.
+var garbageKinds = []string{"container", "snapshot", "image", "volume", "directory"}
+
+type garbageByRemovalOrder []Garbage
+
+func (a garbageByRemovalOrder) Len() int      { return len(a) }
+func (a garbageByRemovalOrder) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a garbageByRemovalOrder) Less(i, j int) bool {
+	return garbageKindOrder(a[i].Kind) < garbageKindOrder(a[j].Kind)
+}
+
+func garbageKindOrder(kind string) int {
+	for i, k := range garbageKinds {
+		if k == kind {
+			return i
+		}
+	}
+
+	return len(garbageKinds)
+}
+
+// RemoveGarbage removes a resource found by FindGarbage.
+func RemoveGarbage(dc DockerClient, sc SystemClient, g Garbage) error {
+	logrus.Debugf("Removing %s %s", g.Kind, g.Name)
+
+	switch g.Kind {
+	case "container":
+		if g.Running {
+			err := dc.StopContainer(g.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return dc.RemoveContainer(g.Name)
+	case "volume":
+		return dc.RemoveVolume(g.Name)
+	case "image", "snapshot":
+		return dc.RemoveImage(g.Name)
+	case "directory":
+		err := removeHostKey(sc, g.Name)
+		if err != nil {
+			return err
+		}
+		return sc.RemoveEnvironmentDir(g.Name)
+	}
+
+	return fmt.Errorf("Unknown kind of garbage %s", g.Kind)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindGarbage(t *testing.T) {
+	assert := assert.New(t)
+
+	sc := NewTestSystemClient()
+	dc := NewTestDockerClient()
+
+	userLabels := map[string]string{"skeg.io/image/username": "nate"}
+	volumeLabels := func(user, env string) map[string]string {
+		return map[string]string{
+			"skeg":                "true",
+			"skeg.io/volume/user": user,
+			"skeg.io/volume/env":  env,
+		}
+	}
+
+	// foo is a working environment, bar lost its directory and baz is an
+	// empty directory left behind
+	for _, name := range []string{"foo", "bar"} {
+		dc.AddContainer(
+			docker.APIContainers{
+				ID:     name,
+				Names:  []string{"/skeg_nate_" + name},
+				Image:  "skeg-nate-" + name + ":latest",
+				Status: "Up 1 hour",
+				Labels: userLabels,
+			},
+		)
+		dc.volumes = append(dc.volumes, docker.Volume{Name: "skeg_nate_" + name, Labels: volumeLabels("nate", name)})
+		dc.images = append(dc.images, docker.APIImages{
+			ID:       name,
+			RepoTags: []string{"skeg-nate-" + name + ":latest"},
+			Labels:   userLabels,
+			Size:     1000,
+		})
+	}
+	sc.EnsureEnvironmentDir("foo")
+	sc.EnsureEnvironmentDir("baz")
+	sc.EnsureEnvironmentDir("qux")
+	sc.emptyDirs = []string{"baz"}
+
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "postgres",
+			Names:  []string{"/skeg_nate_bar_postgres"},
+			Image:  "postgres:9.6",
+			Status: "Exited (0) 1 hour ago",
+			Labels: map[string]string{
+				"skeg.io/service/env":  "bar",
+				"skeg.io/service/user": "nate",
+			},
+		},
+	)
+	// other users' resources are never garbage
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "other",
+			Names:  []string{"/skeg_bob_quux"},
+			Image:  "skeg-bob-quux:latest",
+			Status: "Exited (0) 1 hour ago",
+		},
+	)
+	dc.volumes = append(dc.volumes, docker.Volume{Name: "skeg_bob_quux", Labels: volumeLabels("bob", "quux")})
+	// nate_x's env x_foo shares nate's name prefix, and volumes from before
+	// they were labelled could be anyone's
+	dc.volumes = append(dc.volumes,
+		docker.Volume{Name: "skeg_nate_x_foo", Labels: volumeLabels("nate_x", "foo")},
+		docker.Volume{Name: "skeg_nate_old"},
+	)
+
+	snapshotLabels := func(env string) map[string]string {
+		return map[string]string{
+			"skeg.io/image/username": "nate",
+			"skeg.io/snapshot/env":   env,
+		}
+	}
+	dc.images = append(dc.images,
+		docker.APIImages{ID: "snap1", RepoTags: []string{"skeg-nate-foo-snapshot:one"}, Labels: snapshotLabels("foo"), Size: 200},
+		docker.APIImages{ID: "snap2", RepoTags: []string{"<none>:<none>"}, Labels: snapshotLabels("foo"), Size: 300},
+		docker.APIImages{ID: "snap3", RepoTags: []string{"skeg-nate-bar-snapshot:one"}, Labels: snapshotLabels("bar"), Size: 400},
+	)
+
+	garbage, err := FindGarbage(dc, sc)
+	assert.Nil(err)
+
+	found := make([][]string, 0)
+	for _, g := range garbage {
+		found = append(found, []string{g.Kind, g.Name})
+	}
+	assert.Equal([][]string{
+		{"container", "skeg_nate_bar"},
+		{"container", "skeg_nate_bar_postgres"},
+		{"snapshot", "snap2"},
+		{"snapshot", "skeg-nate-bar-snapshot:one"},
+		{"image", "skeg-nate-bar:latest"},
+		{"volume", "skeg_nate_bar"},
+		{"directory", "baz"},
+	}, found)
+
+	assert.True(garbage[0].Running)
+	assert.Equal(int64(1000), garbage[4].Size)
+	assert.Equal("1.7 kB plus 1 volume", reclaimedSize(garbage))
+
+	for _, g := range garbage {
+		err = RemoveGarbage(dc, sc, g)
+		assert.Nil(err)
+	}
+
+	assert.Equal(2, len(dc.containers))
+	volumeNames := make([]string, 0)
+	for _, vol := range dc.volumes {
+		volumeNames = append(volumeNames, vol.Name)
+	}
+	assert.Equal([]string{"skeg_nate_foo", "skeg_bob_quux", "skeg_nate_x_foo", "skeg_nate_old"}, volumeNames)
+	assert.Equal(2, len(dc.images))
+	assert.Equal([]string{"foo", "qux"}, sc.environments)
+
+	garbage, err = FindGarbage(dc, sc)
+	assert.Nil(err)
+	assert.Equal([]Garbage{}, garbage)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/go-units"
+)
+
+type GCCommand struct {
+	DryRun bool `long:"dry-run" description:"List what would be removed without removing it."`
+	Yes    bool `short:"y" long:"yes" description:"Remove without asking for confirmation."`
+}
+
+var gcCommand GCCommand
+
+func (x *GCCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	garbage, err := FindGarbage(dc, sc)
+	if err != nil {
+		return err
+	}
+
+	if len(garbage) == 0 {
+		fmt.Println("Nothing to remove")
+		return nil
+	}
+
+	items := make([]interface{}, 0)
+	table := Table{Headers: []string{"KIND", "NAME", "SIZE", "REASON"}}
+	for _, g := range garbage {
+		items = append(items, g)
+		table.Rows = append(table.Rows, []string{g.Kind, g.Name, garbageSize(g), g.Reason})
+	}
+
+	err = printOutput(os.Stdout, outputFormat("table"), garbage, items, table)
+	if err != nil {
+		return err
+	}
+
+	if gcCommand.DryRun {
+		fmt.Printf("Would reclaim %s\n", reclaimedSize(garbage))
+		return nil
+	}
+
+	if !gcCommand.Yes {
+		fmt.Printf("Remove %d unused resources? [y/N] ", len(garbage))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return nil
+		}
+	}
+
+	removed := make([]Garbage, 0)
+	for _, g := range garbage {
+		err = RemoveGarbage(dc, sc, g)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't remove %s %s: %s\n", g.Kind, g.Name, err)
+			continue
+		}
+		removed = append(removed, g)
+	}
+
+	fmt.Printf("Removed %d of %d resources, reclaimed %s\n", len(removed), len(garbage), reclaimedSize(removed))
+
+	if len(removed) < len(garbage) {
+		return fmt.Errorf("Some resources couldn't be removed")
+	}
+
+	return nil
+}
+
+// garbageSize is the size shown for a resource, docker doesn't report the
+// size of volumes.
+func garbageSize(g Garbage) string {
+	if g.Kind == "volume" || g.Kind == "container" {
+		return "-"
+	}
+
+	return units.HumanSize(float64(g.Size))
+}
+
+// reclaimedSize summarizes the disk space taken by resources, noting the
+// volumes that aren't counted.
+func reclaimedSize(garbage []Garbage) string {
+	var size int64
+	volumes := 0
+	for _, g := range garbage {
+		size += g.Size
+		if g.Kind == "volume" {
+			volumes++
+		}
+	}
+
+	summary := units.HumanSize(float64(size))
+	if volumes == 1 {
+		summary += " plus 1 volume"
+	} else if volumes > 1 {
+		summary += fmt.Sprintf(" plus %d volumes", volumes)
+	}
+
+	return summary
+}
+
+func init() {
+	_, err := parser.AddCommand("gc",
+		"Remove unused skeg resources.",
+		"Finds containers and volumes of environments that no longer exist, unused user images, dangling snapshots and empty environment directories, and offers to remove them.",
+		&gcCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
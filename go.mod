@@ -6,19 +6,21 @@ require (
 	github.com/Sirupsen/logrus v0.11.1-0.20161202023507-881bee4e20a5
 	github.com/docker/docker v1.4.2-0.20161222233854-d1dfc1a5ef95
 	github.com/docker/go-connections v0.2.2-0.20161115161849-4ccf312bf1d3
+	github.com/docker/go-units v0.3.2-0.20161130221531-e30f1e79f3cd
 	github.com/fsouza/go-dockerclient v0.0.0-20161216020517-4a934a8fd3ec
 	github.com/jessevdk/go-flags v1.1.1-0.20161215105708-4e64e4a4e255
 	github.com/stretchr/testify v1.1.5-0.20161217200445-2402e8e7a02f
+	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
 	github.com/Azure/go-ansiterm v0.0.0-20160622173216-fa152c58bc15 // indirect
 	github.com/Microsoft/go-winio v0.3.7 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/docker/go-units v0.3.2-0.20161130221531-e30f1e79f3cd // indirect
 	github.com/hashicorp/go-cleanhttp v0.0.0-20160407174126-ad28ea4487f0 // indirect
 	github.com/opencontainers/runc v1.0.0-rc2.0.20161222223230-303f9a5ebb0c // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/net v0.0.0-20161215194249-45e771701b81 // indirect
-	golang.org/x/sys v0.0.0-20161214190518-d75a52659825 // indirect
+	golang.org/x/net v0.10.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 )
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 )
 
 type ImagesCommand struct {
@@ -21,12 +22,17 @@ func (x *ImagesCommand) Execute(args []string) error {
 		return err
 	}
 
-	if imagesCommand.All || len(imagesCommand.Type) > 0 || len(imagesCommand.Image) > 0 {
-		sc, err := NewSystemClient()
-		if err != nil {
-			return err
-		}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
 
+	if imagesCommand.All || len(imagesCommand.Type) > 0 || len(imagesCommand.Image) > 0 {
 		userImages, err := UserImages(dc, sc, ImageOpts{
 			Type:    imagesCommand.Type,
 			Version: imagesCommand.Version,
@@ -51,7 +57,7 @@ func (x *ImagesCommand) Execute(args []string) error {
 		return listUserImages(userImages, imagesCommand.All)
 	}
 
-	baseImages, err := BaseImages(dc)
+	baseImages, err := BaseImages(dc, sc)
 	if err != nil {
 		return err
 	}
@@ -60,33 +66,44 @@ func (x *ImagesCommand) Execute(args []string) error {
 }
 
 func listImages(images []*BaseImage) error {
+	items := make([]interface{}, 0)
+	table := Table{Headers: []string{"IMAGE", "TAG", "PULLED", "PREFERRED", "DESCRIPTION"}}
+
 	for _, im := range images {
-		fmt.Printf("%s: %s\n  Tags:\n", im.Name, im.Description)
+		items = append(items, im)
 		for _, tag := range im.Tags {
-			var pulled string
-			var preferred string
-			if tag.Pulled {
-				pulled = " (pulled)"
-			}
-			if tag.Preferred {
-				preferred = " (preferred)"
-			}
-			fmt.Printf("    %s%s%s\n", tag.Name, pulled, preferred)
+			table.Rows = append(table.Rows, []string{
+				fmt.Sprintf("%s/%s", im.Org, im.Name), tag.Name, fmt.Sprintf("%t", tag.Pulled), fmt.Sprintf("%t", tag.Preferred), im.Description,
+			})
 		}
 	}
-	return nil
+
+	return printOutput(os.Stdout, outputFormat("table"), images, items, table)
 }
 
 func listUserImages(images []UserImage, showBase bool) error {
+	infos := make([]UserImageInfo, 0)
+	items := make([]interface{}, 0)
+	table := Table{Headers: []string{"NAME", "VERSION", "ENVS", "BUILD TIME", "TIME ZONE"}}
+	if showBase {
+		table.Headers = append(table.Headers, "BASE")
+	}
+
 	for _, im := range images {
-		fmt.Printf("%s (ver: %d) (%d envs)\n", im.Name, im.Version, im.EnvCount)
-		fmt.Printf("  build time: %s\n", im.Labels["skeg.io/image/buildtime"])
-		fmt.Printf("  time zone: %s\n", im.Labels["skeg.io/image/timezone"])
+		info := NewUserImageInfo(im)
+		infos = append(infos, info)
+		items = append(items, info)
+
+		row := []string{
+			info.Name, fmt.Sprintf("%d", info.Version), fmt.Sprintf("%d", info.EnvCount), info.BuildTime, info.TimeZone,
+		}
 		if showBase {
-			fmt.Printf("  base: %s\n", im.Labels["skeg.io/image/base"])
+			row = append(row, info.Base)
 		}
+		table.Rows = append(table.Rows, row)
 	}
-	return nil
+
+	return printOutput(os.Stdout, outputFormat("table"), infos, items, table)
 }
 
 func init() {
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type ImportCommand struct {
+	Name string `short:"n" long:"name" description:"Name for the imported environment (defaults to the exported name)."`
+	Args struct {
+		Archive string `description:"Archive created by export."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var importCommand ImportCommand
+
+func (x *ImportCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	return ImportEnvironment(dc, sc, importCommand.Args.Archive, importCommand.Name, cfg.Mounts, os.Stdout)
+}
+
+func init() {
+	_, err := parser.AddCommand("import",
+		"Import an environment.",
+		"Create an environment from an archive made by export.  The user image is rebuilt for the importing user if needed.",
+		&importCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
 )
 
 type InspectCommand struct {
@@ -19,7 +20,12 @@ func (x *InspectCommand) Execute(args []string) error {
 		return err
 	}
 
-	sc, err := NewSystemClient()
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
 	if err != nil {
 		return err
 	}
@@ -34,13 +40,15 @@ func (x *InspectCommand) Execute(args []string) error {
 }
 
 func printEnvironment(env Environment) error {
-	data, err := json.MarshalIndent(env, "", "    ")
-	if err != nil {
-		return err
+	info := NewEnvironmentInfo(env)
+	table := Table{
+		Headers: []string{"NAME", "TYPE", "STATE", "IMAGE VERSION", "TIME ZONE", "PORTS", "LIMITS"},
+		Rows: [][]string{{
+			info.Name, info.Type, info.State, fmt.Sprintf("%d", info.ImageVersion), info.TimeZone, strings.Join(info.PortSummary, ", "), info.Resources.String(),
+		}},
 	}
-	fmt.Println(string(data))
 
-	return nil
+	return printOutput(os.Stdout, outputFormat("json"), info, []interface{}{info}, table)
 }
 
 func init() {
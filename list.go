@@ -2,7 +2,8 @@ package main
 
 import (
 	"fmt"
-	"sort"
+	"os"
+	"strings"
 )
 
 type ListCommand struct {
@@ -17,7 +18,12 @@ func (x *ListCommand) Execute(args []string) error {
 		return err
 	}
 
-	sc, err := NewSystemClient()
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
 	if err != nil {
 		return err
 	}
@@ -31,29 +37,20 @@ func (x *ListCommand) Execute(args []string) error {
 }
 
 func listEnvironments(envs map[string]Environment) error {
-	keys := make([]string, 0)
-	for key, _ := range envs {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
-
-	for _, name := range keys {
-		fmt.Printf("%s ", name)
-		data := envs[name]
-
-		if data.Container == nil {
-			fmt.Println("[no container]")
-		} else {
-			state := "stopped"
-			if data.Container.Running {
-				state = "running"
-			}
+	infos := make([]EnvironmentInfo, 0)
+	items := make([]interface{}, 0)
+	table := Table{Headers: []string{"NAME", "TYPE", "STATE", "PORTS"}}
 
-			fmt.Printf("[type: %s] [%s]\n", data.Type, state)
-		}
+	for _, env := range sortedEnvironments(envs) {
+		info := NewEnvironmentInfo(env)
+		infos = append(infos, info)
+		items = append(items, info)
+		table.Rows = append(table.Rows, []string{
+			info.Name, info.Type, info.State, strings.Join(info.PortSummary, ", "),
+		})
 	}
 
-	return nil
+	return printOutput(os.Stdout, outputFormat("table"), infos, items, table)
 }
 
 func init() {
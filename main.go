@@ -16,6 +16,8 @@ type GlobalOptions struct {
 	TLSVerify bool   `long:"tlsverify" description:"Use TLS and verify the remote"`
 	Host      string `long:"host" short:"H" value-name:"unix:///var/run/docker.sock" description:"Docker host to connect to"`
 	LogJSON   func() `short:"j" long:"log-json" description:"Log in JSON format."`
+	Config    string `long:"config" value-name:"~/.skeg/config" description:"Path to skeg config file"`
+	Format    string `long:"format" value-name:"json|yaml|table|TEMPLATE" description:"Output format of list, images, inspect and port ls"`
 }
 
 func (gopts *GlobalOptions) toConnectOpts() ConnectOpts {
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// userNetworkName is the network environments join unless another one is
+// given, so a user's environments can reach each other by name.
+func userNetworkName(sc SystemClient) string {
+	return fmt.Sprintf("%s_%s", CONT_PREFIX, sc.Username())
+}
+
+// removeUnusedNetwork removes a network created by skeg once no environment
+// is on it anymore.  Networks that weren't created by skeg are left alone.
+func removeUnusedNetwork(dc DockerClient, name string) error {
+	if len(name) == 0 {
+		return nil
+	}
+
+	networks, err := dc.ListNetworks()
+	if err != nil {
+		return err
+	}
+
+	managed := false
+	for _, network := range networks {
+		if network.Name == name && network.Labels["skeg"] == "true" {
+			managed = true
+		}
+	}
+	if !managed {
+		return nil
+	}
+
+	containers, err := dc.ListContainers()
+	if err != nil {
+		return err
+	}
+	for _, cont := range containers {
+		if cont.Labels["skeg.io/container/network"] == name {
+			return nil
+		}
+	}
+
+	logrus.Debugf("Removing network %s", name)
+	err = dc.RemoveNetwork(name)
+	if err != nil {
+		// containers skeg doesn't know about may still be connected
+		logrus.Warnf("Unable to remove network %s: %s", name, err)
+	}
+
+	return nil
+}
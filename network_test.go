@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveUnusedNetwork(t *testing.T) {
+	assert := assert.New(t)
+
+	sc := NewTestSystemClient()
+	dc := NewTestDockerClient()
+	assert.Equal("skeg_nate", userNetworkName(sc))
+
+	ensureNetwork(dc, "skeg_nate")
+	dc.networks = append(dc.networks, docker.Network{Name: "shared"})
+
+	for _, name := range []string{"foo", "bar"} {
+		dc.AddContainer(
+			docker.APIContainers{
+				ID:     name,
+				Names:  []string{"/skeg_nate_" + name},
+				Image:  "skeg-nate-1234",
+				Status: "Exited (0) 1 hour ago",
+				Labels: map[string]string{
+					"skeg.io/container/network": "skeg_nate",
+				},
+			},
+		)
+		sc.EnsureEnvironmentDir(name)
+	}
+
+	networkNames := func() []string {
+		names := make([]string, 0)
+		for _, network := range dc.networks {
+			names = append(names, network.Name)
+		}
+		return names
+	}
+
+	// the network stays while an environment is on it
+	err := DestroyContainer(dc, sc, "foo")
+	assert.Nil(err)
+	assert.Equal([]string{"skeg_nate", "shared"}, networkNames())
+
+	err = DestroyContainer(dc, sc, "bar")
+	assert.Nil(err)
+	assert.Equal([]string{"shared"}, networkNames())
+
+	// networks skeg didn't create are left alone
+	err = removeUnusedNetwork(dc, "shared")
+	assert.Nil(err)
+	assert.Equal([]string{"shared"}, networkNames())
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvironmentInfo is what list and inspect print for an environment.  Fields
+// are only ever added, so scripts can rely on them:
+//
+//	name          name of the environment
+//	type          base image type, or "unknown"
+//	state         "running", "stopped" or "no container"
+//	imageVersion  version of the user image the container was created from
+//	timeZone      time zone of the environment
+//	ports         ports published by docker
+//	portSummary   ports in the compact form shown by list
+//	mounts        volumes and bind mounts of the container
+//	network       docker network the environment is reachable by name on
+//	resources     cpus, memory, memorySwap and pidsLimit limits of the
+//	              container, each omitted when unlimited
+//	services      service containers of the environment
+//	container     details of the container, null without one
+type EnvironmentInfo struct {
+	Environment  `yaml:",inline"`
+	State        string       `json:"state" yaml:"state"`
+	ImageVersion int          `json:"imageVersion" yaml:"imageVersion"`
+	TimeZone     string       `json:"timeZone" yaml:"timeZone"`
+	Ports        []Port       `json:"ports" yaml:"ports"`
+	PortSummary  []string     `json:"portSummary" yaml:"portSummary"`
+	Mounts       []Mount      `json:"mounts" yaml:"mounts"`
+	Network      string       `json:"network" yaml:"network"`
+	Resources    ResourceOpts `json:"resources" yaml:"resources"`
+}
+
+// Mount is a volume or bind mount of an environment's container.
+type Mount struct {
+	Source      string `json:"source" yaml:"source"`
+	Destination string `json:"destination" yaml:"destination"`
+}
+
+// UserImageInfo is what images prints for a user image, with the fields of
+// UserImage and:
+//
+//	base       base image the user image was built from
+//	buildTime  when the image was built
+//	timeZone   time zone set in the image
+type UserImageInfo struct {
+	UserImage `yaml:",inline"`
+	Base      string `json:"base" yaml:"base"`
+	BuildTime string `json:"buildTime" yaml:"buildTime"`
+	TimeZone  string `json:"timeZone" yaml:"timeZone"`
+}
+
+// NewEnvironmentInfo fills in the output fields of an environment from its
+// container.
+func NewEnvironmentInfo(env Environment) EnvironmentInfo {
+	info := EnvironmentInfo{
+		Environment: env,
+		State:       "no container",
+		Ports:       []Port{},
+		PortSummary: []string{},
+		Mounts:      []Mount{},
+	}
+
+	if env.Container == nil {
+		return info
+	}
+
+	info.State = "stopped"
+	if env.Container.Running {
+		info.State = "running"
+	}
+
+	fmt.Sscanf(env.Container.Labels["skeg.io/image/version"], "%d", &info.ImageVersion)
+	info.TimeZone = env.Container.Labels["skeg.io/image/timezone"]
+	info.Ports = append(info.Ports, env.Container.Ports...)
+	info.PortSummary = CompactPorts(env.Container.Ports)
+	info.Resources = resourceOptsFromLabels(env.Container.Labels)
+	info.Network = env.Container.Labels["skeg.io/container/network"]
+
+	for _, mount := range env.Container.Mounts {
+		for source, destination := range mount {
+			info.Mounts = append(info.Mounts, Mount{source, destination})
+		}
+	}
+
+	return info
+}
+
+// NewUserImageInfo fills in the output fields of a user image from its
+// labels.
+func NewUserImageInfo(im UserImage) UserImageInfo {
+	if im.EnvList == nil {
+		im.EnvList = []string{}
+	}
+
+	return UserImageInfo{
+		UserImage: im,
+		Base:      im.Labels["skeg.io/image/base"],
+		BuildTime: im.Labels["skeg.io/image/buildtime"],
+		TimeZone:  im.Labels["skeg.io/image/timezone"],
+	}
+}
+
+// Table is the table format of a command's output.
+type Table struct {
+	Headers []string
+	Rows    [][]string
+}
+
+// outputFormat returns the format selected with --format, or the command's
+// default.
+func outputFormat(defaultFormat string) string {
+	if len(globalOptions.Format) > 0 {
+		return globalOptions.Format
+	}
+
+	return defaultFormat
+}
+
+// printOutput prints data, the whole output of a command, in format: json,
+// yaml or table.  Any other format is a Go template, executed for each of
+// items.
+func printOutput(w io.Writer, format string, data interface{}, items []interface{}, table Table) error {
+	switch format {
+	case "json":
+		out, err := json.MarshalIndent(data, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(out))
+
+	case "yaml":
+		out, err := yaml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w, string(out))
+
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(table.Headers, "\t"))
+		for _, row := range table.Rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+
+	default:
+		tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+		if err != nil {
+			return fmt.Errorf("Invalid format: %s", err)
+		}
+
+		for _, item := range items {
+			err = tmpl.Execute(w, item)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	return nil
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+}
+
+// sortedEnvironments returns environments sorted by name.
+func sortedEnvironments(envs map[string]Environment) []Environment {
+	keys := make([]string, 0)
+	for key := range envs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sorted := make([]Environment, 0)
+	for _, key := range keys {
+		sorted = append(sorted, envs[key])
+	}
+
+	return sorted
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEnvironmentInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	info := NewEnvironmentInfo(Environment{Name: "foo"})
+	assert.Equal("no container", info.State)
+	assert.Equal([]Port{}, info.Ports)
+	assert.Equal([]Mount{}, info.Mounts)
+
+	info = NewEnvironmentInfo(Environment{
+		Name: "foo",
+		Type: "clojure",
+		Container: &Container{
+			Name:    "skeg_nate_foo",
+			Running: true,
+			Ports: []Port{
+				{"0.0.0.0", 32768, 22, "tcp"},
+				{"0.0.0.0", 8000, 8000, "tcp"},
+				{"0.0.0.0", 8001, 8001, "tcp"},
+			},
+			Labels: map[string]string{
+				"skeg.io/image/version":  "3",
+				"skeg.io/image/timezone": "America/Los_Angeles",
+			},
+			Mounts: []map[string]string{
+				{"/home/nate/skegs/foo": "/home/nate"},
+			},
+		},
+	})
+	assert.Equal("running", info.State)
+	assert.Equal(3, info.ImageVersion)
+	assert.Equal("America/Los_Angeles", info.TimeZone)
+	assert.Equal([]string{"32768->22/tcp", "8000-8001->8000-8001/tcp"}, info.PortSummary)
+	assert.Equal([]Mount{{"/home/nate/skegs/foo", "/home/nate"}}, info.Mounts)
+}
+
+func TestPrintOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	info := NewEnvironmentInfo(Environment{Name: "foo", Type: "clojure"})
+	data := []EnvironmentInfo{info}
+	items := []interface{}{info}
+	table := Table{
+		Headers: []string{"NAME", "TYPE"},
+		Rows:    [][]string{{"foo", "clojure"}},
+	}
+
+	var out bytes.Buffer
+	err := printOutput(&out, "table", data, items, table)
+	assert.Nil(err)
+	assert.Equal("NAME  TYPE\nfoo   clojure\n", out.String())
+
+	out.Reset()
+	err = printOutput(&out, "json", data, items, table)
+	assert.Nil(err)
+	assert.Contains(out.String(), `"name": "foo",`)
+	assert.Contains(out.String(), `"state": "no container",`)
+	assert.Contains(out.String(), `"portSummary": [],`)
+
+	out.Reset()
+	err = printOutput(&out, "yaml", data, items, table)
+	assert.Nil(err)
+	assert.Contains(out.String(), "- name: foo\n")
+	assert.Contains(out.String(), "  state: no container\n")
+
+	out.Reset()
+	err = printOutput(&out, "{{ .Name }} {{ .State }} {{ json .Ports }}", data, items, table)
+	assert.Nil(err)
+	assert.Equal("foo no container []\n", out.String())
+
+	err = printOutput(&out, "{{ .Name", data, items, table)
+	assert.Equal(errors.New("Invalid format: template: format:1: unclosed action"), err)
+}
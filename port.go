@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type PortCommand struct {
+	// only subcommands
+}
+
+type PortAddCommand struct {
+	Args struct {
+		Name string `description:"Name of environment."`
+		Port string `description:"Port to forward (hostPort:containerPort)."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+type PortRmCommand struct {
+	Args struct {
+		Name string `description:"Name of environment."`
+		Port string `description:"Host port of forward to remove."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+type PortLsCommand struct {
+	Args struct {
+		Name string `description:"Name of environment."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var portCommand PortCommand
+var portAddCommand PortAddCommand
+var portRmCommand PortRmCommand
+var portLsCommand PortLsCommand
+
+func (x *PortAddCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	forward, err := AddForward(dc, sc, portAddCommand.Args.Name, portAddCommand.Args.Port)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Forwarding port %d to %d on %s\n", forward.HostPort, forward.ContainerPort, forward.Env)
+
+	return nil
+}
+
+func (x *PortRmCommand) Execute(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	return RemoveForward(sc, portRmCommand.Args.Name, portRmCommand.Args.Port)
+}
+
+func (x *PortLsCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	ports, err := EnvironmentPorts(dc, sc, portLsCommand.Args.Name)
+	if err != nil {
+		return err
+	}
+
+	items := make([]interface{}, 0)
+	table := Table{Headers: []string{"HOST", "CONTAINER", "SOURCE", "STATE"}}
+
+	for _, port := range ports {
+		items = append(items, port)
+
+		hostIp := port.HostIp
+		if len(hostIp) == 0 {
+			hostIp = "localhost"
+		}
+		state := "stopped"
+		if port.Running {
+			state = "running"
+		}
+		table.Rows = append(table.Rows, []string{
+			fmt.Sprintf("%s:%d", hostIp, port.HostPort), fmt.Sprintf("%d/%s", port.ContainerPort, port.Type), port.Source, state,
+		})
+	}
+
+	return printOutput(os.Stdout, outputFormat("table"), ports, items, table)
+}
+
+func init() {
+	cmd, err := parser.AddCommand("port",
+		"Work with ports of an environment.",
+		"",
+		&portCommand)
+
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	_, err = cmd.AddCommand("add",
+		"Forward a port to a running environment.",
+		"Forward a host port to a running environment over ssh, without recreating the container.",
+		&portAddCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	_, err = cmd.AddCommand("rm",
+		"Remove a forwarded port.",
+		"",
+		&portRmCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	_, err = cmd.AddCommand("ls",
+		"List ports of an environment.",
+		"List ports published by docker and forwarded by skeg.",
+		&portLsCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ProjectSpec describes the environment for a project.  It is read from a
+// PROJECT_FILE in the project directory, so it can be checked in alongside the
+// code and shared by everyone working on the project.
+type ProjectSpec struct {
+	Name      string                 `yaml:"name"`
+	Type      string                 `yaml:"type"`
+	Version   string                 `yaml:"version"`
+	Image     string                 `yaml:"image"`
+	Ports     []string               `yaml:"ports"`
+	Volumes   []string               `yaml:"volumes"`
+	Env       map[string]string      `yaml:"env"`
+	Provision []string               `yaml:"provision"`
+	Compose   string                 `yaml:"compose"`
+	Services  map[string]ServiceSpec `yaml:"services"`
+
+	dir string
+}
+
+// LoadProjectSpec reads the project file in dir.  If there is no project
+// file, nil is returned.
+func LoadProjectSpec(dir string) (*ProjectSpec, error) {
+	if len(dir) == 0 {
+		return nil, nil
+	}
+
+	path := filepath.Join(dir, PROJECT_FILE)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	spec := ProjectSpec{dir: dir}
+	err = yaml.UnmarshalStrict(data, &spec)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse project file %s: %s", path, err)
+	}
+
+	for key, val := range spec.Env {
+		err = checkEnvValue(key, val)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse project file %s: %s", path, err)
+		}
+	}
+
+	for name, svc := range spec.Services {
+		svc.Volumes = resolveVolumes(dir, svc.Volumes)
+		spec.Services[name] = svc
+	}
+
+	// services defined in the project file take precedence over those in the
+	// compose file
+	if len(spec.Compose) > 0 {
+		composePath := spec.Compose
+		if !filepath.IsAbs(composePath) {
+			composePath = filepath.Join(dir, composePath)
+		}
+
+		services, err := LoadComposeServices(composePath)
+		if err != nil {
+			return nil, err
+		}
+
+		if spec.Services == nil {
+			spec.Services = make(map[string]ServiceSpec)
+		}
+		for name, svc := range services {
+			if _, ok := spec.Services[name]; !ok {
+				spec.Services[name] = svc
+			}
+		}
+	}
+
+	return &spec, nil
+}
+
+// EnvList returns the spec's environment variables in KEY=VAL form, sorted by
+// key.
+func (ps *ProjectSpec) EnvList() []string {
+	env := make([]string, 0)
+	for key, val := range ps.Env {
+		env = append(env, fmt.Sprintf("%s=%s", key, val))
+	}
+	sort.Strings(env)
+
+	return env
+}
+
+// MergeCreateOpts fills in create options that weren't specified on the
+// command line from the project spec.  Relative host paths in volumes are
+// resolved against the project directory.
+func (ps *ProjectSpec) MergeCreateOpts(co CreateOpts) CreateOpts {
+	if len(co.Name) == 0 {
+		co.Name = ps.Name
+	}
+
+	if len(co.Build.Image.Type) == 0 && len(co.Build.Image.Image) == 0 {
+		co.Build.Image.Type = ps.Type
+		co.Build.Image.Image = ps.Image
+		if len(co.Build.Image.Version) == 0 {
+			co.Build.Image.Version = ps.Version
+		}
+	}
+
+	if len(co.Ports) == 0 {
+		co.Ports = ps.Ports
+	}
+
+	if len(co.Volumes) == 0 {
+		co.Volumes = resolveVolumes(ps.dir, ps.Volumes)
+	}
+
+	co.Env = append(ps.EnvList(), co.Env...)
+	co.Provision = ps.Provision
+	co.Services = ps.Services
+
+	return co
+}
+
+// resolveVolumes resolves relative host paths in volumes against dir.
+func resolveVolumes(dir string, volumes []string) []string {
+	resolved := make([]string, 0)
+	for _, vol := range volumes {
+		if strings.HasPrefix(vol, "./") || strings.HasPrefix(vol, "../") {
+			volumeParts := strings.SplitN(vol, ":", 2)
+			volumeParts[0] = filepath.Join(dir, volumeParts[0])
+			vol = strings.Join(volumeParts, ":")
+		}
+		resolved = append(resolved, vol)
+	}
+
+	return resolved
+}
+
+// ApplyProjectSpec merges the project spec found in the project directory, if
+// any, into the create options.
+func ApplyProjectSpec(co CreateOpts) (CreateOpts, error) {
+	spec, err := LoadProjectSpec(co.ProjectDir)
+	if err != nil {
+		return co, err
+	}
+
+	if spec != nil {
+		co = spec.MergeCreateOpts(co)
+	}
+
+	return co, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadProjectSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	spec, err := LoadProjectSpec(tempdir)
+	assert.Nil(err)
+	assert.Nil(spec)
+
+	ioutil.WriteFile(filepath.Join(tempdir, PROJECT_FILE), []byte(`
+name: webapp
+type: go
+version: "1.8"
+ports:
+  - "8080:8080"
+volumes:
+  - ./data:/data
+  - /tmp:/tmp
+env:
+  PGHOST: db
+  APP_ENV: dev
+provision:
+  - sudo apt-get install -y postgresql-client
+`), 0644)
+
+	spec, err = LoadProjectSpec(tempdir)
+	assert.Nil(err)
+	assert.Equal("webapp", spec.Name)
+	assert.Equal([]string{"APP_ENV=dev", "PGHOST=db"}, spec.EnvList())
+
+	co := spec.MergeCreateOpts(CreateOpts{ProjectDir: tempdir, Env: []string{"FOO=bar"}})
+	assert.Equal("webapp", co.Name)
+	assert.Equal(ImageOpts{Type: "go", Version: "1.8"}, co.Build.Image)
+	assert.Equal([]string{"8080:8080"}, co.Ports)
+	assert.Equal([]string{filepath.Join(tempdir, "data") + ":/data", "/tmp:/tmp"}, co.Volumes)
+	assert.Equal([]string{"APP_ENV=dev", "PGHOST=db", "FOO=bar"}, co.Env)
+	assert.Equal([]string{"sudo apt-get install -y postgresql-client"}, co.Provision)
+
+	co = spec.MergeCreateOpts(CreateOpts{
+		Name:  "other",
+		Ports: []string{"3000"},
+		Build: BuildOpts{Image: ImageOpts{Image: "ubuntu:16.04"}},
+	})
+	assert.Equal("other", co.Name)
+	assert.Equal(ImageOpts{Image: "ubuntu:16.04"}, co.Build.Image)
+	assert.Equal([]string{"3000"}, co.Ports)
+
+	ioutil.WriteFile(filepath.Join(tempdir, PROJECT_FILE), []byte("nmae: webapp\n"), 0644)
+	_, err = LoadProjectSpec(tempdir)
+	assert.NotNil(err)
+}
+
+func TestMergeProjectVolumes(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	ioutil.WriteFile(filepath.Join(tempdir, PROJECT_FILE), []byte("volumes:\n  - /tmp:/tmp\n"), 0644)
+
+	sc := NewTestSystemClient()
+	dc := NewTestDockerClient()
+	dc.mounts = []docker.Mount{
+		{Source: "/tmp", Destination: "/tmp", RW: true},
+		{Source: "/srv/data", Destination: "/data", RW: true},
+	}
+	env := Environment{
+		Name: "foo",
+		Container: &Container{
+			Name:   "skeg_nate_foo",
+			Labels: map[string]string{},
+		},
+	}
+
+	// without a project spec the volumes the container has are kept
+	co, err := MergeEnvironmentOpts(dc, sc, env, CreateOpts{Name: "foo"})
+	assert.Nil(err)
+	assert.Equal([]string{"/tmp:/tmp", "/srv/data:/data"}, co.Volumes)
+
+	// with one, a volume removed from the spec goes
+	env.Container.Labels["skeg.io/container/project_dir"] = tempdir
+	co, err = MergeEnvironmentOpts(dc, sc, env, CreateOpts{Name: "foo"})
+	assert.Nil(err)
+	assert.Equal([]string{"/tmp:/tmp"}, co.Volumes)
+}
@@ -7,10 +7,14 @@ import (
 
 type RebuildCommand struct {
 	BuildCommand
-	Ports        []string `short:"p" long:"port" description:"Ports to expose (similar to docker -p)."`
-	Volumes      []string `long:"volume" description:"Volume to mount (similar to docker -v)."`
-	ForceBuild   bool     `long:"force-build" description:"Force building of new user image."`
-	Args         struct {
+	ResourceCommand
+	EnvCommand
+	Ports      []string `short:"p" long:"port" description:"Ports to expose (similar to docker -p)."`
+	Volumes    []string `long:"volume" description:"Volume to mount (similar to docker -v)."`
+	ForceBuild bool     `long:"force-build" description:"Force building of new user image."`
+	Docker     bool     `long:"docker" description:"Mount the Docker socket inside the environment."`
+	Network    string   `long:"network" description:"Docker network to move the environment to, created if missing."`
+	Args       struct {
 		Name string `description:"Name of environment."`
 	} `positional-args:"yes" required:"yes"`
 }
@@ -21,6 +25,9 @@ func (ccommand *RebuildCommand) toCreateOpts(sc SystemClient) CreateOpts {
 		Ports:        ccommand.Ports,
 		Volumes:      ccommand.Volumes,
 		ForceBuild:   ccommand.ForceBuild || ccommand.ForcePull,
+		DockerSocket: ccommand.Docker,
+		Resources:    ccommand.toResourceOpts(),
+		Network:      ccommand.Network,
 		Build: BuildOpts{
 			Image: ImageOpts{
 				Type:    ccommand.Type,
@@ -28,6 +35,7 @@ func (ccommand *RebuildCommand) toCreateOpts(sc SystemClient) CreateOpts {
 				Image:   ccommand.Image,
 			},
 			TimeZone:  ccommand.TimeZone,
+			Distro:    ccommand.Distro,
 			ForcePull: ccommand.ForcePull,
 			Username:  sc.Username(),
 			UID:       sc.UID(),
@@ -44,12 +52,30 @@ func (x *RebuildCommand) Execute(args []string) error {
 		return err
 	}
 
-	sc, err := NewSystemClient()
+	cfg, err := loadConfig()
 	if err != nil {
 		return err
 	}
 
-	return RebuildEnvironment(dc, sc, rebuildCommand.toCreateOpts(sc), os.Stdout)
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	// an existing environment keeps its image, time zone, ports, volumes,
+	// resource limits and environment variables, so only the build behavior,
+	// global mounts and docker socket are taken from the config
+	co := rebuildCommand.toCreateOpts(sc)
+	co.Env, err = rebuildCommand.toEnv()
+	if err != nil {
+		return err
+	}
+	co.Build.ForcePull = co.Build.ForcePull || cfg.ForcePull
+	co.ForceBuild = co.ForceBuild || cfg.ForceBuild || co.Build.ForcePull
+	co.Mounts = cfg.Mounts
+	co.DockerSocket = co.DockerSocket || cfg.Docker
+
+	return RebuildEnvironment(dc, sc, co, os.Stdout)
 }
 
 func init() {
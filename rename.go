@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type RenameCommand struct {
+	Force bool `short:"f" long:"force" description:"Rename even if the environment is running."`
+	Args  struct {
+		Name    string `description:"Name of environment."`
+		NewName string `description:"New name of environment."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var renameCommand RenameCommand
+
+func (x *RenameCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	co := CreateOpts{
+		Name:   renameCommand.Args.NewName,
+		Mounts: cfg.Mounts,
+		Build: BuildOpts{
+			Username: sc.Username(),
+			UID:      sc.UID(),
+			GID:      sc.GID(),
+		},
+	}
+
+	return RenameEnvironment(dc, sc, renameCommand.Args.Name, co, renameCommand.Force, os.Stdout)
+}
+
+func init() {
+	_, err := parser.AddCommand("rename",
+		"Rename an environment.",
+		"",
+		&renameCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
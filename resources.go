@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+)
+
+// cpuPeriod is the CFS period cpu limits are expressed in, like docker's
+// --cpus.
+const cpuPeriod int64 = 100000
+
+// ResourceOpts limits the resources an environment's container can use, as
+// given on the command line or in the config: cpus like "1.5", memory sizes
+// like "4g" (a memory swap of "-1" is unlimited) and a maximum number of
+// processes.  Empty values are unlimited.
+type ResourceOpts struct {
+	CPUs       string `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+	Memory     string `json:"memory,omitempty" yaml:"memory,omitempty"`
+	MemorySwap string `json:"memorySwap,omitempty" yaml:"memorySwap,omitempty"`
+	PidsLimit  int64  `json:"pidsLimit,omitempty" yaml:"pidsLimit,omitempty"`
+}
+
+// ResourceLimits are resource limits in the units docker expects them.
+type ResourceLimits struct {
+	CPUPeriod  int64
+	CPUQuota   int64
+	Memory     int64
+	MemorySwap int64
+	PidsLimit  int64
+}
+
+// Limits parses the resource options into limits for docker.
+func (ro ResourceOpts) Limits() (ResourceLimits, error) {
+	var limits ResourceLimits
+
+	if len(ro.CPUs) > 0 {
+		cpus, err := strconv.ParseFloat(ro.CPUs, 64)
+		if err != nil || cpus <= 0 {
+			return limits, fmt.Errorf("Invalid cpus %s, must be a positive number", ro.CPUs)
+		}
+		limits.CPUPeriod = cpuPeriod
+		limits.CPUQuota = int64(cpus * float64(cpuPeriod))
+	}
+
+	if len(ro.Memory) > 0 {
+		memory, err := units.RAMInBytes(ro.Memory)
+		if err != nil {
+			return limits, fmt.Errorf("Invalid memory %s: %s", ro.Memory, err)
+		}
+		limits.Memory = memory
+	}
+
+	if ro.MemorySwap == "-1" {
+		limits.MemorySwap = -1
+	} else if len(ro.MemorySwap) > 0 {
+		memorySwap, err := units.RAMInBytes(ro.MemorySwap)
+		if err != nil {
+			return limits, fmt.Errorf("Invalid memory swap %s: %s", ro.MemorySwap, err)
+		}
+		if limits.Memory == 0 {
+			return limits, fmt.Errorf("Memory swap %s requires a memory limit", ro.MemorySwap)
+		}
+		if memorySwap < limits.Memory {
+			return limits, fmt.Errorf("Memory swap %s must be at least memory %s", ro.MemorySwap, ro.Memory)
+		}
+		limits.MemorySwap = memorySwap
+	}
+
+	if ro.PidsLimit < 0 {
+		return limits, fmt.Errorf("Invalid pids limit %d", ro.PidsLimit)
+	}
+	limits.PidsLimit = ro.PidsLimit
+
+	return limits, nil
+}
+
+// Merge fills in resource options that aren't set from defaults.
+func (ro ResourceOpts) Merge(defaults ResourceOpts) ResourceOpts {
+	if len(ro.CPUs) == 0 {
+		ro.CPUs = defaults.CPUs
+	}
+	if len(ro.Memory) == 0 {
+		ro.Memory = defaults.Memory
+	}
+	if len(ro.MemorySwap) == 0 {
+		ro.MemorySwap = defaults.MemorySwap
+	}
+	if ro.PidsLimit == 0 {
+		ro.PidsLimit = defaults.PidsLimit
+	}
+
+	return ro
+}
+
+// String summarizes the resource options, like "cpus=2 memory=4g".
+func (ro ResourceOpts) String() string {
+	parts := make([]string, 0)
+	if len(ro.CPUs) > 0 {
+		parts = append(parts, fmt.Sprintf("cpus=%s", ro.CPUs))
+	}
+	if len(ro.Memory) > 0 {
+		parts = append(parts, fmt.Sprintf("memory=%s", ro.Memory))
+	}
+	if len(ro.MemorySwap) > 0 {
+		parts = append(parts, fmt.Sprintf("memory-swap=%s", ro.MemorySwap))
+	}
+	if ro.PidsLimit > 0 {
+		parts = append(parts, fmt.Sprintf("pids-limit=%d", ro.PidsLimit))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// addResourceLabels records the resource options in container labels, so the
+// environment keeps them when it's rebuilt.
+func addResourceLabels(labels map[string]string, ro ResourceOpts) {
+	if len(ro.CPUs) > 0 {
+		labels["skeg.io/container/cpus"] = ro.CPUs
+	}
+	if len(ro.Memory) > 0 {
+		labels["skeg.io/container/memory"] = ro.Memory
+	}
+	if len(ro.MemorySwap) > 0 {
+		labels["skeg.io/container/memory_swap"] = ro.MemorySwap
+	}
+	if ro.PidsLimit > 0 {
+		labels["skeg.io/container/pids_limit"] = fmt.Sprintf("%d", ro.PidsLimit)
+	}
+}
+
+// resourceOptsFromLabels reads the resource options an environment's
+// container was created with.
+func resourceOptsFromLabels(labels map[string]string) ResourceOpts {
+	ro := ResourceOpts{
+		CPUs:       labels["skeg.io/container/cpus"],
+		Memory:     labels["skeg.io/container/memory"],
+		MemorySwap: labels["skeg.io/container/memory_swap"],
+	}
+	if pidsLimit, ok := labels["skeg.io/container/pids_limit"]; ok {
+		ro.PidsLimit, _ = strconv.ParseInt(pidsLimit, 10, 64)
+	}
+
+	return ro
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	limits, err := ResourceOpts{}.Limits()
+	assert.Nil(err)
+	assert.Equal(ResourceLimits{}, limits)
+
+	limits, err = ResourceOpts{CPUs: "1.5", Memory: "4g", MemorySwap: "6g", PidsLimit: 512}.Limits()
+	assert.Nil(err)
+	assert.Equal(ResourceLimits{
+		CPUPeriod:  100000,
+		CPUQuota:   150000,
+		Memory:     4 * 1024 * 1024 * 1024,
+		MemorySwap: 6 * 1024 * 1024 * 1024,
+		PidsLimit:  512,
+	}, limits)
+
+	limits, err = ResourceOpts{Memory: "512m", MemorySwap: "-1"}.Limits()
+	assert.Nil(err)
+	assert.Equal(int64(-1), limits.MemorySwap)
+
+	var errorTests = []struct {
+		opts ResourceOpts
+		err  error
+	}{
+		{ResourceOpts{CPUs: "lots"}, errors.New("Invalid cpus lots, must be a positive number")},
+		{ResourceOpts{CPUs: "0"}, errors.New("Invalid cpus 0, must be a positive number")},
+		{ResourceOpts{Memory: "4x"}, errors.New("Invalid memory 4x: invalid size: '4x'")},
+		{ResourceOpts{MemorySwap: "4g"}, errors.New("Memory swap 4g requires a memory limit")},
+		{ResourceOpts{Memory: "4g", MemorySwap: "2g"}, errors.New("Memory swap 2g must be at least memory 4g")},
+		{ResourceOpts{PidsLimit: -1}, errors.New("Invalid pids limit -1")},
+	}
+
+	for _, et := range errorTests {
+		_, err = et.opts.Limits()
+		assert.Equal(et.err, err)
+	}
+}
+
+func TestResourceLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	labels := make(map[string]string)
+	addResourceLabels(labels, ResourceOpts{})
+	assert.Empty(labels)
+
+	opts := ResourceOpts{CPUs: "2", Memory: "4g", MemorySwap: "-1", PidsLimit: 512}
+	addResourceLabels(labels, opts)
+	assert.Equal("4g", labels["skeg.io/container/memory"])
+	assert.Equal(opts, resourceOptsFromLabels(labels))
+	assert.Equal("cpus=2 memory=4g memory-swap=-1 pids-limit=512", opts.String())
+
+	// options given again on rebuild replace the ones from the labels
+	merged := ResourceOpts{Memory: "8g"}.Merge(resourceOptsFromLabels(labels))
+	assert.Equal(ResourceOpts{CPUs: "2", Memory: "8g", MemorySwap: "-1", PidsLimit: 512}, merged)
+}
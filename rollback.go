@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type RollbackCommand struct {
+	Args struct {
+		Name     string `description:"Name of environment."`
+		Snapshot string `description:"Name of snapshot."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var rollbackCommand RollbackCommand
+
+func (x *RollbackCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	co := CreateOpts{
+		Name:   rollbackCommand.Args.Name,
+		Mounts: cfg.Mounts,
+		Build: BuildOpts{
+			Username: sc.Username(),
+			UID:      sc.UID(),
+			GID:      sc.GID(),
+		},
+	}
+
+	return RollbackEnvironment(dc, sc, co, rollbackCommand.Args.Snapshot, os.Stdout)
+}
+
+func init() {
+	_, err := parser.AddCommand("rollback",
+		"Roll back an environment to a snapshot.",
+		"Recreate the environment's container from a snapshot, keeping its ports, volumes and settings.",
+		&rollbackCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -20,11 +20,14 @@ func (ccommand *RunCommand) toCreateOpts(sc SystemClient, workingDir string) Cre
 		projectDir = workingDir
 	}
 	return CreateOpts{
-		Name:       ccommand.Args.Name,
-		ProjectDir: projectDir,
-		Ports:      ccommand.Ports,
-		Volumes:    ccommand.Volumes,
-		ForceBuild: ccommand.ForceBuild || ccommand.ForcePull,
+		Name:         ccommand.Args.Name,
+		ProjectDir:   projectDir,
+		Ports:        ccommand.Ports,
+		Volumes:      ccommand.Volumes,
+		DockerSocket: ccommand.Docker,
+		ForceBuild:   ccommand.ForceBuild || ccommand.ForcePull,
+		Resources:    ccommand.toResourceOpts(),
+		Network:      ccommand.Network,
 		Build: BuildOpts{
 			Image: ImageOpts{
 				Type:    ccommand.Type,
@@ -32,6 +35,7 @@ func (ccommand *RunCommand) toCreateOpts(sc SystemClient, workingDir string) Cre
 				Image:   ccommand.Image,
 			},
 			TimeZone:  ccommand.TimeZone,
+			Distro:    ccommand.Distro,
 			ForcePull: ccommand.ForcePull,
 			Username:  sc.Username(),
 			UID:       sc.UID(),
@@ -48,7 +52,12 @@ func (x *RunCommand) Execute(args []string) error {
 		return err
 	}
 
-	sc, err := NewSystemClient()
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
 	if err != nil {
 		return err
 	}
@@ -58,18 +67,30 @@ func (x *RunCommand) Execute(args []string) error {
 		return err
 	}
 
-	err = CreateNewEnvironment(dc, sc, runCommand.toCreateOpts(sc, workingDir), os.Stdout)
+	co := runCommand.toCreateOpts(sc, workingDir)
+	co.Env, err = runCommand.toEnv()
+	if err != nil {
+		return err
+	}
+
+	co, err = ApplyProjectSpec(co)
+	if err != nil {
+		return err
+	}
+	co = cfg.MergeCreateOpts(co)
+
+	err = CreateNewEnvironment(dc, sc, co, os.Stdout)
 	if err != nil {
 		return err
 	}
 
-	err = ConnectEnvironment(dc, sc, runCommand.Args.Name, connectCommand.Args.Rest)
+	err = ConnectEnvironment(dc, sc, co.Name, connectCommand.Args.Rest)
 	if err != nil {
 		logrus.Debugf("error when running shell: %s", err)
 	}
 
 	if runCommand.Remove {
-		err = DestroyEnvironment(dc, sc, runCommand.Args.Name)
+		err = DestroyEnvironment(dc, sc, co.Name)
 		if err != nil {
 			return err
 		}
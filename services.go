@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Service is a sidecar container (database, cache, etc.) attached to an
+// environment.  Services share a network with the environment's container and
+// are reachable from it by name.
+type Service struct {
+	Name      string `json:"name" yaml:"name"`
+	Container string `json:"container" yaml:"container"`
+	Image     string `json:"image" yaml:"image"`
+	Running   bool   `json:"running" yaml:"running"`
+	Status    string `json:"status" yaml:"status"`
+}
+
+// ServiceSpec defines a service, using a subset of the docker-compose service
+// format.
+type ServiceSpec struct {
+	Image       string         `yaml:"image"`
+	Command     ServiceCommand `yaml:"command"`
+	Environment ServiceEnv     `yaml:"environment"`
+	Volumes     []string       `yaml:"volumes"`
+}
+
+// ServiceCommand is a command given either as a string or a list, as
+// docker-compose allows.
+type ServiceCommand []string
+
+func (sc *ServiceCommand) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*sc = list
+		return nil
+	}
+
+	var command string
+	if err := unmarshal(&command); err != nil {
+		return err
+	}
+	*sc = strings.Fields(command)
+
+	return nil
+}
+
+// ServiceEnv is a set of environment variables given either as a map or a
+// list of KEY=VAL entries, as docker-compose allows.
+type ServiceEnv []string
+
+func (se *ServiceEnv) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*se = list
+		return nil
+	}
+
+	var vars map[string]string
+	if err := unmarshal(&vars); err != nil {
+		return err
+	}
+
+	env := make([]string, 0)
+	for key, val := range vars {
+		env = append(env, fmt.Sprintf("%s=%s", key, val))
+	}
+	sort.Strings(env)
+	*se = env
+
+	return nil
+}
+
+// LoadComposeServices reads the service definitions from a docker-compose
+// file.  Only the parts of the format that skeg understands are used, the rest
+// is ignored.
+func LoadComposeServices(path string) (map[string]ServiceSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	compose := struct {
+		Services map[string]ServiceSpec `yaml:"services"`
+	}{}
+	err = yaml.Unmarshal(data, &compose)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse compose file %s: %s", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for name, svc := range compose.Services {
+		svc.Volumes = resolveVolumes(dir, svc.Volumes)
+		compose.Services[name] = svc
+	}
+
+	return compose.Services, nil
+}
+
+func envNetworkName(sc SystemClient, envName string) string {
+	return fmt.Sprintf("%s_%s_%s", CONT_PREFIX, sc.Username(), envName)
+}
+
+func serviceContainerName(sc SystemClient, envName, service string) string {
+	return fmt.Sprintf("%s_%s_%s_%s", CONT_PREFIX, sc.Username(), envName, service)
+}
+
+// serviceVolumeName names the volume holding a service's data at the n'th of
+// the paths its image declares as volumes.
+func serviceVolumeName(sc SystemClient, envName, service string, n int) string {
+	name := serviceContainerName(sc, envName, service)
+	if n > 0 {
+		name = fmt.Sprintf("%s_%d", name, n+1)
+	}
+
+	return name
+}
+
+// CreateServices creates and starts the services for an environment, along
+// with the network they share with the environment.  The data in the volumes
+// declared by a service's image is kept in named volumes, so it survives
+// rebuilds.
+func CreateServices(dc DockerClient, sc SystemClient, envName string, services map[string]ServiceSpec, output *os.File) error {
+	networkName := envNetworkName(sc, envName)
+	err := ensureNetwork(dc, networkName)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0)
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		svc := services[name]
+		if len(svc.Image) == 0 {
+			return fmt.Errorf("Service %s doesn't specify an image", name)
+		}
+
+		logrus.Debugf("Creating service %s", name)
+		err = EnsureImage(dc, svc.Image, false, output)
+		if err != nil {
+			return err
+		}
+
+		volumes, err := serviceVolumes(dc, sc, envName, name, svc)
+		if err != nil {
+			return err
+		}
+
+		containerName := serviceContainerName(sc, envName, name)
+		err = dc.CreateContainer(CreateContainerOpts{
+			Name:     containerName,
+			Hostname: name,
+			Image:    svc.Image,
+			Cmd:      svc.Command,
+			Env:      svc.Environment,
+			Volumes:  volumes,
+			Network:  networkName,
+			Aliases:  []string{name},
+			Labels: map[string]string{
+				"skeg.io/service/env":  envName,
+				"skeg.io/service/user": sc.Username(),
+				"skeg.io/service/name": name,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		err = dc.StartContainer(containerName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serviceVolumes returns the volumes of a service, adding a named volume for
+// each volume its image declares that the spec doesn't mount anything at.
+func serviceVolumes(dc DockerClient, sc SystemClient, envName, name string, svc ServiceSpec) ([]string, error) {
+	volumes := append([]string{}, svc.Volumes...)
+
+	image, err := dc.InspectImage(svc.Image)
+	if err != nil {
+		return volumes, err
+	}
+	if image.Config == nil {
+		return volumes, nil
+	}
+
+	mounted := make(map[string]bool)
+	for _, v := range svc.Volumes {
+		parts := strings.Split(v, ":")
+		if len(parts) > 1 {
+			mounted[parts[1]] = true
+		} else {
+			mounted[parts[0]] = true
+		}
+	}
+
+	paths := make([]string, 0)
+	for path := range image.Config.Volumes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for i, path := range paths {
+		if mounted[path] {
+			continue
+		}
+
+		volumeName := serviceVolumeName(sc, envName, name, i)
+		err = ensureVolume(dc, volumeName, map[string]string{
+			"skeg":                   "true",
+			"skeg.io/volume/user":    sc.Username(),
+			"skeg.io/volume/env":     envName,
+			"skeg.io/volume/service": name,
+		})
+		if err != nil {
+			return volumes, err
+		}
+		volumes = append(volumes, fmt.Sprintf("%s:%s", volumeName, path))
+	}
+
+	return volumes, nil
+}
+
+// RemoveServiceVolumes removes the volumes holding the data of an
+// environment's services.
+func RemoveServiceVolumes(dc DockerClient, sc SystemClient, envName string) error {
+	volumes, err := dc.ListVolumes()
+	if err != nil {
+		return err
+	}
+
+	for _, vol := range volumes {
+		if vol.Labels["skeg.io/volume/user"] != sc.Username() || vol.Labels["skeg.io/volume/env"] != envName {
+			continue
+		}
+		if _, ok := vol.Labels["skeg.io/volume/service"]; !ok {
+			continue
+		}
+
+		logrus.Debugf("Removing service volume %s", vol.Name)
+		err = dc.RemoveVolume(vol.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveServices stops and removes an environment's services and their
+// network.  The services' data volumes are kept.
+func RemoveServices(dc DockerClient, sc SystemClient, env Environment) error {
+	for _, svc := range env.Services {
+		logrus.Debugf("Removing service %s", svc.Name)
+		if svc.Running {
+			err := dc.StopContainer(svc.Container)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := dc.RemoveContainer(svc.Container)
+		if err != nil {
+			return err
+		}
+	}
+
+	networkName := envNetworkName(sc, env.Name)
+	networks, err := dc.ListNetworks()
+	if err != nil {
+		return err
+	}
+
+	for _, network := range networks {
+		if network.Name == networkName {
+			return dc.RemoveNetwork(networkName)
+		}
+	}
+
+	return nil
+}
+
+func ensureNetwork(dc DockerClient, name string) error {
+	networks, err := dc.ListNetworks()
+	if err != nil {
+		return err
+	}
+
+	for _, network := range networks {
+		if network.Name == name {
+			return nil
+		}
+	}
+
+	logrus.Debugf("Creating network %s", name)
+	return dc.CreateNetwork(CreateNetworkOpts{Name: name, Labels: map[string]string{"skeg": "true"}})
+}
+
+func ensureVolume(dc DockerClient, name string, labels map[string]string) error {
+	volumes, err := dc.ListVolumes()
+	if err != nil {
+		return err
+	}
+
+	for _, vol := range volumes {
+		if vol.Name == name {
+			return nil
+		}
+	}
+
+	logrus.Debugf("Creating volume %s", name)
+	return dc.CreateVolume(CreateVolumeOpts{Name: name, Labels: labels})
+}
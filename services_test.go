@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadComposeServices(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	ioutil.WriteFile(filepath.Join(tempdir, "docker-compose.yml"), []byte(`
+version: "2"
+services:
+  db:
+    image: postgres:9.6
+    environment:
+      POSTGRES_USER: dev
+    volumes:
+      - ./pgdata:/var/lib/postgresql/data
+    restart: always
+  cache:
+    image: redis:3
+    command: redis-server --appendonly yes
+`), 0644)
+	ioutil.WriteFile(filepath.Join(tempdir, PROJECT_FILE), []byte(`
+compose: docker-compose.yml
+services:
+  cache:
+    image: redis:4
+    environment:
+      - FOO=bar
+`), 0644)
+
+	services, err := LoadComposeServices(filepath.Join(tempdir, "docker-compose.yml"))
+	assert.Nil(err)
+	assert.Equal(ServiceSpec{
+		Image:       "postgres:9.6",
+		Environment: ServiceEnv{"POSTGRES_USER=dev"},
+		Volumes:     []string{filepath.Join(tempdir, "pgdata") + ":/var/lib/postgresql/data"},
+	}, services["db"])
+	assert.Equal(ServiceCommand{"redis-server", "--appendonly", "yes"}, services["cache"].Command)
+
+	spec, err := LoadProjectSpec(tempdir)
+	assert.Nil(err)
+	assert.Equal(2, len(spec.Services))
+	assert.Equal("postgres:9.6", spec.Services["db"].Image)
+	assert.Equal("redis:4", spec.Services["cache"].Image)
+	assert.Equal(ServiceEnv{"FOO=bar"}, spec.Services["cache"].Environment)
+}
+
+func TestEnvironmentServices(t *testing.T) {
+	assert := assert.New(t)
+
+	sc := NewTestSystemClient()
+
+	dc := NewTestDockerClient()
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foo",
+			Names:  []string{"/skeg_nate_foo"},
+			Image:  "skeg-nate-1234",
+			Status: "Exited (0) 1 hour ago",
+			Labels: map[string]string{
+				"skeg.io/image/base": "clojure",
+			},
+		},
+	)
+	dc.AddContainer(
+		docker.APIContainers{
+			ID:     "foodb",
+			Names:  []string{"/skeg_nate_foo_db"},
+			Image:  "postgres:9.6",
+			Status: "Exited (0) 1 hour ago",
+			Labels: map[string]string{
+				"skeg.io/service/env":  "foo",
+				"skeg.io/service/user": "nate",
+				"skeg.io/service/name": "db",
+			},
+		},
+	)
+	sc.EnsureEnvironmentDir("foo")
+
+	env, err := GetEnvironment(dc, sc, "foo")
+	assert.Nil(err)
+	assert.Equal([]Service{
+		{"db", "skeg_nate_foo_db", "postgres:9.6", false, "Exited (0) 1 hour ago"},
+	}, env.Services)
+
+	env, err = EnsureRunning(dc, sc, "foo")
+	assert.Nil(err)
+	assert.True(env.Container.Running)
+	assert.True(env.Services[0].Running)
+
+	env, err = EnsureStopped(dc, sc, "foo")
+	assert.Nil(err)
+	assert.False(env.Container.Running)
+	assert.False(env.Services[0].Running)
+}
+
+func TestServiceVolumes(t *testing.T) {
+	assert := assert.New(t)
+
+	sc := NewTestSystemClient()
+	dc := NewTestDockerClient()
+	dc.imageVols["postgres:9.6"] = []string{"/var/lib/postgresql/data"}
+	dc.imageVols["mongo:3"] = []string{"/data/configdb", "/data/db"}
+
+	services := map[string]ServiceSpec{
+		"db":    {Image: "postgres:9.6"},
+		"mongo": {Image: "mongo:3", Volumes: []string{"/srv/mongo:/data/db"}},
+	}
+
+	// volumes are reused when the services are created again on rebuild
+	for i := 0; i < 2; i++ {
+		dc.created = nil
+		err := CreateServices(dc, sc, "foo", services, nil)
+		assert.Nil(err)
+		assert.Equal([]string{"skeg_nate_foo_db:/var/lib/postgresql/data"}, dc.created[0].Volumes)
+		assert.Equal([]string{"/srv/mongo:/data/db", "skeg_nate_foo_mongo:/data/configdb"}, dc.created[1].Volumes)
+		assert.Equal(2, len(dc.volumes))
+	}
+	assert.Equal(map[string]string{
+		"skeg":                   "true",
+		"skeg.io/volume/user":    "nate",
+		"skeg.io/volume/env":     "foo",
+		"skeg.io/volume/service": "db",
+	}, dc.volumes[0].Labels)
+
+	dc.volumes = append(dc.volumes,
+		docker.Volume{Name: "skeg_nate_foo", Labels: map[string]string{"skeg.io/volume/user": "nate", "skeg.io/volume/env": "foo"}},
+		docker.Volume{Name: "skeg_nate_bar_db", Labels: map[string]string{"skeg.io/volume/user": "nate", "skeg.io/volume/env": "bar", "skeg.io/volume/service": "db"}},
+	)
+
+	err := RemoveServiceVolumes(dc, sc, "foo")
+	assert.Nil(err)
+	assert.Equal(2, len(dc.volumes))
+	assert.Equal("skeg_nate_foo", dc.volumes[0].Name)
+	assert.Equal("skeg_nate_bar_db", dc.volumes[1].Name)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+)
+
+type SnapshotCommand struct {
+	Args struct {
+		Name     string `description:"Name of environment." required:"yes"`
+		Snapshot string `description:"Name of snapshot (defaults to a timestamp)."`
+	} `positional-args:"yes"`
+}
+
+var snapshotCommand SnapshotCommand
+
+func (x *SnapshotCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	snap, err := SnapshotEnvironment(dc, sc, snapshotCommand.Args.Name, snapshotCommand.Args.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created snapshot %s (%s)\n", snap.Name, snap.Image)
+
+	return nil
+}
+
+func init() {
+	_, err := parser.AddCommand("snapshot",
+		"Snapshot an environment.",
+		"Save the environment's container filesystem so it can be restored with rollback.",
+		&snapshotCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+)
+
+type SnapshotsCommand struct {
+	Args struct {
+		Name string `description:"Name of environment."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var snapshotsCommand SnapshotsCommand
+
+func (x *SnapshotsCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := Snapshots(dc, sc, snapshotsCommand.Args.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, snap := range snapshots {
+		fmt.Printf("%s\n  image: %s\n  created: %s\n", snap.Name, snap.Image, snap.Created.Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
+
+func init() {
+	_, err := parser.AddCommand("snapshots",
+		"List snapshots of an environment.",
+		"",
+		&snapshotsCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -1,26 +1,50 @@
 package main
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
 
 type SshConfigCommand struct {
-	Args struct {
+	Install bool `long:"install" description:"Write ~/.ssh/config.d/skeg with a skeg-<name> entry for every environment, kept up to date by skeg."`
+	Args    struct {
 		Name string `description:"Name of environment."`
-	} `positional-args:"yes" required:"yes"`
+	} `positional-args:"yes"`
 }
 
 var sshConfigCommand SshConfigCommand
 
 func (x *SshConfigCommand) Execute(args []string) error {
+	if !sshConfigCommand.Install && len(sshConfigCommand.Args.Name) == 0 {
+		return errors.New("Name of environment required, unless --install is given")
+	}
+
 	dc, err := NewDockerClient(globalOptions.toConnectOpts())
 	if err != nil {
 		return err
 	}
 
-	sc, err := NewSystemClient()
+	cfg, err := loadConfig()
 	if err != nil {
 		return err
 	}
 
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	if sshConfigCommand.Install {
+		err = InstallSSHConfig(dc, sc)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Installed ssh config in ~/%s\n", filepath.ToSlash(filepath.Join(SSH_CONFIG_DIR, SSH_CONFIG_INCLUDE)))
+		return nil
+	}
+
 	config, err := SshConfigEnvironment(dc, sc, sshConfigCommand.Args.Name)
 	if err != nil {
 		return err
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/term"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHConnectOpts describes an ssh session with an environment.  Without a
+// HostKeyAlias, the host key isn't checked.  Without a Command, an
+// interactive shell is started.
+type SSHConnectOpts struct {
+	Host         string
+	Port         int64
+	User         string
+	Key          SSHKey
+	KnownHosts   string
+	HostKeyAlias string
+	Command      []string
+	Tty          bool
+	ForwardAgent bool
+}
+
+// errHandshakeDone stops a connection once the ssh handshake has reached host
+// key verification.
+var errHandshakeDone = errors.New("ssh handshake done")
+
+// sshHandshake runs the ssh key exchange on conn, without authenticating.
+func sshHandshake(conn net.Conn, address string) error {
+	config := &ssh.ClientConfig{
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return errHandshakeDone
+		},
+		Timeout: 5 * time.Second,
+	}
+
+	// the callback always fails, so the handshake never gets to auth.  ssh
+	// wraps the callback's error in its own, so it's matched by message
+	_, _, _, err := ssh.NewClientConn(conn, address, config)
+	if err != nil && strings.Contains(err.Error(), errHandshakeDone.Error()) {
+		return nil
+	}
+
+	return err
+}
+
+func sshAuthMethod(key SSHKey) (ssh.AuthMethod, io.Closer, error) {
+	if key.agent {
+		conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unable to connect to ssh-agent: %s", err)
+		}
+
+		return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), conn, nil
+	}
+
+	data, err := ioutil.ReadFile(key.privatePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ssh.PublicKeys(signer), nil, nil
+}
+
+func sshHostKeyCallback(opts SSHConnectOpts) (ssh.HostKeyCallback, error) {
+	if len(opts.HostKeyAlias) == 0 {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	callback, err := knownhosts.New(opts.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	// look the key up under the alias, like ssh's HostKeyAlias
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return callback(net.JoinHostPort(opts.HostKeyAlias, "22"), remote, key)
+	}, nil
+}
+
+// runNativeSSH connects to an environment with the built in ssh client and
+// runs a command or an interactive shell, returning its exit code.
+func runNativeSSH(opts SSHConnectOpts, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	auth, closer, err := sshAuthMethod(opts.Key)
+	if err != nil {
+		return 0, err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	hostKeyCallback, err := sshHostKeyCallback(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            opts.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	}
+	if len(opts.HostKeyAlias) > 0 {
+		config.HostKeyAlgorithms = []string{ssh.KeyAlgoED25519}
+	}
+
+	address := net.JoinHostPort(opts.Host, fmt.Sprintf("%d", opts.Port))
+	logrus.Debugf("Connecting to %s", address)
+	client, err := ssh.Dial("tcp", address, config)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	if opts.ForwardAgent {
+		err = agent.ForwardToRemote(client, os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			return 0, err
+		}
+
+		err = agent.RequestAgentForwarding(session)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	interactive := len(opts.Command) == 0
+	if interactive || opts.Tty {
+		restore, err := startPty(session, stdin, stdout)
+		if err != nil {
+			return 0, err
+		}
+		defer restore()
+	}
+
+	if interactive {
+		err = session.Shell()
+		if err == nil {
+			err = session.Wait()
+		}
+	} else {
+		err = session.Run(strings.Join(opts.Command, " "))
+	}
+
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return exitErr.ExitStatus(), nil
+	}
+	if _, ok := err.(*ssh.ExitMissingError); ok {
+		return 255, nil
+	}
+
+	return 0, err
+}
+
+// startPty requests a pseudo terminal for the session and, if stdin is a
+// terminal, puts it in raw mode and follows its size.  The returned function
+// restores the terminal.
+func startPty(session *ssh.Session, stdin io.Reader, stdout io.Writer) (func(), error) {
+	termName := os.Getenv("TERM")
+	if len(termName) == 0 {
+		termName = "xterm"
+	}
+
+	height, width := 24, 80
+	outFd, _ := term.GetFdInfo(stdout)
+	if ws, err := term.GetWinsize(outFd); err == nil && ws.Width > 0 {
+		height, width = int(ws.Height), int(ws.Width)
+	}
+
+	err := session.RequestPty(termName, height, width, ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	inFd, isTerminal := term.GetFdInfo(stdin)
+	if !isTerminal {
+		return func() {}, nil
+	}
+
+	state, err := term.SetRawTerminal(inFd)
+	if err != nil {
+		return nil, err
+	}
+
+	stopResize := watchWindowSize(func() {
+		if ws, err := term.GetWinsize(outFd); err == nil {
+			session.WindowChange(int(ws.Height), int(ws.Width))
+		}
+	})
+
+	return func() {
+		stopResize()
+		term.RestoreTerminal(inFd, state)
+	}, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServer accepts connections authenticated with clientKey and answers
+// exec requests with "ran <command>" and an exit status of 3.
+func testSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) net.Listener {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "nate" && bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSH(conn, config)
+		}
+	}()
+
+	return listener
+}
+
+func serveTestSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		channel, requests, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+
+		for req := range requests {
+			if req.Type != "exec" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+
+			command := string(req.Payload[4:])
+			fmt.Fprintf(channel, "ran %s", command)
+
+			status := make([]byte, 4)
+			binary.BigEndian.PutUint32(status, 3)
+			channel.SendRequest("exit-status", false, status)
+			channel.Close()
+		}
+	}
+}
+
+func TestRunNativeSSH(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "skeg")
+	defer os.RemoveAll(tempdir)
+
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewSignerFromKey(hostPriv)
+
+	clientPub, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	clientKey, _ := ssh.NewPublicKey(clientPub)
+	block, _ := ssh.MarshalPrivateKey(clientPriv, "")
+	keyPath := filepath.Join(tempdir, "skeg_key")
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(block), 0600)
+
+	knownHosts := filepath.Join(tempdir, "known_hosts")
+	ioutil.WriteFile(knownHosts, []byte(fmt.Sprintf("skeg_nate_foo %s", ssh.MarshalAuthorizedKey(hostKey.PublicKey()))), 0644)
+
+	listener := testSSHServer(t, hostKey, clientKey)
+	defer listener.Close()
+	addr := listener.Addr().(*net.TCPAddr)
+
+	// the handshake succeeds without credentials
+	conn, err := net.Dial("tcp", addr.String())
+	assert.Nil(err)
+	assert.Nil(sshHandshake(conn, addr.String()))
+
+	opts := SSHConnectOpts{
+		Host:         "127.0.0.1",
+		Port:         int64(addr.Port),
+		User:         "nate",
+		Key:          SSHKey{privatePath: keyPath},
+		KnownHosts:   knownHosts,
+		HostKeyAlias: "skeg_nate_foo",
+		Command:      []string{"ls", "-la"},
+	}
+
+	var stdout bytes.Buffer
+	code, err := runNativeSSH(opts, bytes.NewReader(nil), &stdout, ioutil.Discard)
+	assert.Nil(err)
+	assert.Equal(3, code)
+	assert.Equal("ran ls -la", stdout.String())
+
+	// a host key not pinned for the alias is rejected
+	opts.HostKeyAlias = "skeg_nate_bar"
+	_, err = runNativeSSH(opts, bytes.NewReader(nil), ioutil.Discard, ioutil.Discard)
+	assert.NotNil(err)
+
+	// unless the environment has no pinned host key
+	opts.HostKeyAlias = ""
+	code, err = runNativeSSH(opts, bytes.NewReader(nil), ioutil.Discard, ioutil.Discard)
+	assert.Nil(err)
+	assert.Equal(3, code)
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -22,27 +25,68 @@ type SystemClient interface {
 	DetectTimeZone() string
 	EnsureEnvironmentDir(envName string) (string, error)
 	RemoveEnvironmentDir(envName string) error
+	EnvironmentDirEmpty(envName string) (bool, error)
+	RenameEnvironmentDir(oldName, newName string) error
 	EnsureSSHKey() (SSHKey, error)
+	CheckSSHKey() (string, error)
+	CommandAvailable(name string) bool
+	EnsureHostKey(envName string) (SSHKey, error)
+	RemoveHostKey(envName string) error
+	KnownHostsPath() string
+	SetKnownHost(alias, publicKey string) error
+	InstallSSHConfig() error
+	SSHConfigInstalled() bool
+	WriteSSHConfig(config string) error
 	Username() string
 	UID() int
 	GID() int
 	RunSSH(command string, args []string) error
+	UseNativeSSH() bool
+	RunNativeSSH(opts SSHConnectOpts) (int, error)
+	StartSSH(command string, args []string) (int, error)
+	ForwardRunning(forward Forward) bool
+	StopProcess(pid int) error
+	Forwards() ([]Forward, error)
+	SaveForwards(forwards []Forward) error
 	CheckSSHPort(host string, port int64) error
+	DockerSocketGID(path string) (int, error)
+	ImageCatalog() ([]*BaseImage, error)
 }
 
+// RealSystemClient uses the ssh key, ssh client and image catalogs chosen in
+// the user's config.  The catalogs are only read when they're first needed,
+// so commands that don't look up base images never wait on remote catalogs.
 type RealSystemClient struct {
-	user      string
-	uid       int
-	gid       int
-	baseDir   string
-	envRegexp *regexp.Regexp
+	user         string
+	uid          int
+	gid          int
+	baseDir      string
+	envRegexp    *regexp.Regexp
+	keyOpts      SSHKeyOpts
+	sshClient    string
+	config       Config
+	imageCatalog []*BaseImage
 }
 
 type SSHKey struct {
 	privatePath string
 	publicPath  string
+	agent       bool
 }
 
+// SSHKeyOpts selects the key used to connect to environments.  By default a
+// key of Type is generated in the skeg dir.  Path points to an existing
+// private key, with the public key alongside it.  With Agent, the public key
+// comes from ssh-agent (the one matching Path, if given) and the private key
+// stays in the agent.
+type SSHKeyOpts struct {
+	Type  string
+	Path  string
+	Agent bool
+}
+
+var sshKeyTypes = []string{"rsa", "ed25519", "ecdsa"}
+
 func (rsc *RealSystemClient) DetectTimeZone() string {
 	realLocaltime, _ := filepath.EvalSymlinks("/etc/localtime")
 	if _, err := os.Stat("/etc/timezone"); err == nil {
@@ -109,24 +153,408 @@ func (rsc *RealSystemClient) RemoveEnvironmentDir(envName string) error {
 	return nil
 }
 
+func (rsc *RealSystemClient) EnvironmentDirEmpty(envName string) (bool, error) {
+	files, err := ioutil.ReadDir(filepath.Join(rsc.baseDir, envName))
+	if err != nil {
+		return false, err
+	}
+
+	return len(files) == 0, nil
+}
+
+func (rsc *RealSystemClient) RenameEnvironmentDir(oldName, newName string) error {
+	return os.Rename(filepath.Join(rsc.baseDir, oldName), filepath.Join(rsc.baseDir, newName))
+}
+
 func (rsc *RealSystemClient) EnsureSSHKey() (SSHKey, error) {
-	privPath := filepath.Join(rsc.baseDir, "skeg_key")
-	pubPath := filepath.Join(rsc.baseDir, "skeg_key.pub")
+	if rsc.keyOpts.Agent {
+		return rsc.agentSSHKey(rsc.keyOpts.Path)
+	}
+
+	privPath, pubPath, err := sshKeyPaths(rsc.baseDir, rsc.keyOpts)
+	if err != nil {
+		return SSHKey{}, err
+	}
+
+	if len(rsc.keyOpts.Path) > 0 {
+		for _, path := range []string{privPath, pubPath} {
+			if _, err := os.Stat(path); err != nil {
+				return SSHKey{}, fmt.Errorf("SSH key %s not found", path)
+			}
+		}
+
+		return SSHKey{privPath, pubPath, false}, nil
+	}
+
+	if _, err := os.Stat(privPath); os.IsNotExist(err) {
+
+		cmd := exec.Command("ssh-keygen", "-q", "-t", sshKeyType(rsc.keyOpts), "-N", "", "-C", "skeg key", "-f", privPath)
+		err := cmd.Run()
+		if err != nil {
+			return SSHKey{}, err
+		}
+	}
+
+	return SSHKey{privPath, pubPath, false}, nil
+}
+
+func sshKeyType(opts SSHKeyOpts) string {
+	if len(opts.Type) == 0 {
+		return "rsa"
+	}
+
+	return opts.Type
+}
+
+// sshKeyPaths returns the paths of the private and public key selected by
+// opts, either the configured key or the one skeg generates in baseDir.
+func sshKeyPaths(baseDir string, opts SSHKeyOpts) (string, string, error) {
+	if len(opts.Path) > 0 {
+		privPath, err := expandHome(opts.Path)
+		if err != nil {
+			return "", "", err
+		}
+
+		return privPath, privPath + ".pub", nil
+	}
+
+	keyType := sshKeyType(opts)
+	valid := false
+	for _, t := range sshKeyTypes {
+		valid = valid || t == keyType
+	}
+	if !valid {
+		return "", "", fmt.Errorf("Unsupported ssh key type %s, must be one of %s", keyType, strings.Join(sshKeyTypes, ", "))
+	}
+
+	// rsa keys keep the original name so existing keys are still used
+	name := "skeg_key"
+	if keyType != "rsa" {
+		name = fmt.Sprintf("skeg_key_%s", keyType)
+	}
+	privPath := filepath.Join(baseDir, name)
+
+	return privPath, privPath + ".pub", nil
+}
+
+// CheckSSHKey checks the ssh key used to connect to environments without
+// creating it, returning its path.  ErrSSHKeyNotCreated is returned when skeg
+// hasn't generated its key yet.
+func (rsc *RealSystemClient) CheckSSHKey() (string, error) {
+	if rsc.keyOpts.Agent {
+		if len(os.Getenv("SSH_AUTH_SOCK")) == 0 {
+			return "ssh-agent", errors.New("ssh_agent is set but $SSH_AUTH_SOCK isn't, ssh-agent isn't running")
+		}
+		_, err := rsc.agentSSHKey(rsc.keyOpts.Path)
+		return "ssh-agent", err
+	}
+
+	privPath, pubPath, err := sshKeyPaths(rsc.baseDir, rsc.keyOpts)
+	if err != nil {
+		return privPath, err
+	}
+
+	info, err := os.Stat(privPath)
+	if os.IsNotExist(err) && len(rsc.keyOpts.Path) == 0 {
+		return privPath, ErrSSHKeyNotCreated
+	} else if err != nil {
+		return privPath, fmt.Errorf("SSH key %s not found", privPath)
+	}
+
+	if _, err := os.Stat(pubPath); err != nil {
+		return privPath, fmt.Errorf("SSH public key %s not found", pubPath)
+	}
+
+	// ssh refuses private keys others can read, windows has no such modes
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return privPath, fmt.Errorf("SSH key %s is accessible by others (mode %04o)", privPath, info.Mode().Perm())
+	}
+
+	return privPath, nil
+}
+
+// ErrSSHKeyNotCreated is returned by CheckSSHKey before skeg generated its
+// ssh key.
+var ErrSSHKeyNotCreated = errors.New("SSH key not created yet")
+
+func (rsc *RealSystemClient) CommandAvailable(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// agentSSHKey writes the public key of one of ssh-agent's identities to the
+// skeg dir, so it can be added to images.  If path is given, the identity
+// must match the public key next to it.
+func (rsc *RealSystemClient) agentSSHKey(path string) (SSHKey, error) {
+	out, err := exec.Command("ssh-add", "-L").Output()
+	if err != nil {
+		return SSHKey{}, fmt.Errorf("Unable to list ssh-agent identities: %s", err)
+	}
+
+	var want string
+	if len(path) > 0 {
+		path, err = expandHome(path)
+		if err != nil {
+			return SSHKey{}, err
+		}
+
+		data, err := ioutil.ReadFile(path + ".pub")
+		if err != nil {
+			return SSHKey{}, err
+		}
+
+		fields := strings.Fields(string(data))
+		if len(fields) < 2 {
+			return SSHKey{}, fmt.Errorf("Invalid public key %s.pub", path)
+		}
+		want = fields[1]
+	}
+
+	var identity string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if len(want) == 0 || fields[1] == want {
+			identity = line
+			break
+		}
+	}
+
+	if len(identity) == 0 {
+		return SSHKey{}, errors.New("No matching identity found in ssh-agent")
+	}
+
+	pubPath := filepath.Join(rsc.baseDir, "agent_key.pub")
+	err = ioutil.WriteFile(pubPath, []byte(identity+"\n"), 0644)
+	if err != nil {
+		return SSHKey{}, err
+	}
+
+	return SSHKey{"", pubPath, true}, nil
+}
+
+// KeyFingerprint returns the SHA256 fingerprint of a public key in
+// authorized_keys format, as shown by ssh-keygen -l.
+func KeyFingerprint(publicKey []byte) (string, error) {
+	fields := strings.Fields(string(publicKey))
+	if len(fields) < 2 {
+		return "", errors.New("Invalid public key")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// EnsureHostKey returns the ssh host key for an environment, generating it if
+// it doesn't exist yet.
+func (rsc *RealSystemClient) EnsureHostKey(envName string) (SSHKey, error) {
+	privPath := filepath.Join(rsc.baseDir, fmt.Sprintf("host_key_%s", envName))
+	pubPath := privPath + ".pub"
 
 	if _, err := os.Stat(privPath); os.IsNotExist(err) {
 
-		cmd := exec.Command("ssh-keygen", "-q", "-t", "rsa", "-N", "", "-C", "skeg key", "-f", privPath)
+		cmd := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", fmt.Sprintf("skeg host key %s", envName), "-f", privPath)
 		err := cmd.Run()
 		if err != nil {
 			return SSHKey{}, err
 		}
 	}
 
-	return SSHKey{privPath, pubPath}, nil
+	return SSHKey{privPath, pubPath, false}, nil
+}
+
+func (rsc *RealSystemClient) RemoveHostKey(envName string) error {
+	privPath := filepath.Join(rsc.baseDir, fmt.Sprintf("host_key_%s", envName))
+	for _, path := range []string{privPath, privPath + ".pub"} {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rsc *RealSystemClient) sshConfigDir() string {
+	return filepath.Join(filepath.Dir(rsc.baseDir), SSH_CONFIG_DIR)
+}
+
+// InstallSSHConfig adds an Include of the managed ssh config to the top of
+// the user's ssh config, so it applies to all hosts.
+func (rsc *RealSystemClient) InstallSSHConfig() error {
+	dir := rsc.sshConfigDir()
+	err := os.MkdirAll(filepath.Join(dir, filepath.Dir(SSH_CONFIG_INCLUDE)), 0700)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, "config")
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	include := fmt.Sprintf("Include %s", SSH_CONFIG_INCLUDE)
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == include {
+			return nil
+		}
+	}
+
+	logrus.Debugf("Adding '%s' to %s", include, path)
+	return ioutil.WriteFile(path, append([]byte(include+"\n\n"), data...), 0600)
+}
+
+func (rsc *RealSystemClient) SSHConfigInstalled() bool {
+	_, err := os.Stat(filepath.Join(rsc.sshConfigDir(), SSH_CONFIG_INCLUDE))
+	return err == nil
+}
+
+func (rsc *RealSystemClient) WriteSSHConfig(config string) error {
+	return ioutil.WriteFile(filepath.Join(rsc.sshConfigDir(), SSH_CONFIG_INCLUDE), []byte(config), 0600)
+}
+
+func (rsc *RealSystemClient) KnownHostsPath() string {
+	return filepath.Join(rsc.baseDir, KNOWN_HOSTS_FILE)
+}
+
+// SetKnownHost replaces the known_hosts entry for alias with publicKey, in
+// authorized_keys format.  An empty publicKey removes the entry.
+func (rsc *RealSystemClient) SetKnownHost(alias, publicKey string) error {
+	path := rsc.KnownHostsPath()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(line) == 0 || strings.HasPrefix(line, alias+" ") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if len(publicKey) > 0 {
+		fields := strings.Fields(publicKey)
+		if len(fields) < 2 {
+			return fmt.Errorf("Invalid public key for %s", alias)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", alias, fields[0], fields[1]))
+	}
+
+	if len(lines) == 0 {
+		return ioutil.WriteFile(path, []byte{}, 0600)
+	}
+
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+// StartSSH runs ssh in the background, detached from the terminal, and
+// returns its process id once it has had a chance to fail.
+func (rsc *RealSystemClient) StartSSH(command string, args []string) (int, error) {
+	cmd := exec.Command(command, args...)
+	detachProcess(cmd)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Start()
+	if err != nil {
+		return 0, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		return 0, fmt.Errorf("%s exited: %s %s", command, err, strings.TrimSpace(stderr.String()))
+	case <-time.After(time.Second):
+		return cmd.Process.Pid, nil
+	}
+}
+
+// ForwardRunning reports whether a forward's ssh process is still running.
+// The pid's command line is checked too, so a process that was given the pid
+// after ssh exited isn't taken for it.
+func (rsc *RealSystemClient) ForwardRunning(forward Forward) bool {
+	if !processRunning(forward.Pid) {
+		return false
+	}
+
+	args, err := processCommand(forward.Pid)
+	if err != nil {
+		logrus.Debugf("Unable to read command of pid %d: %s", forward.Pid, err)
+		return false
+	}
+
+	return isForwardProcess(args, forward)
+}
+
+func (rsc *RealSystemClient) StopProcess(pid int) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	return proc.Kill()
+}
+
+func (rsc *RealSystemClient) Forwards() ([]Forward, error) {
+	forwards := make([]Forward, 0)
+
+	data, err := ioutil.ReadFile(filepath.Join(rsc.baseDir, FORWARDS_FILE))
+	if os.IsNotExist(err) {
+		return forwards, nil
+	} else if err != nil {
+		return forwards, err
+	}
+
+	err = json.Unmarshal(data, &forwards)
+	return forwards, err
+}
+
+func (rsc *RealSystemClient) SaveForwards(forwards []Forward) error {
+	data, err := json.MarshalIndent(forwards, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(rsc.baseDir, FORWARDS_FILE), data, 0600)
+}
+
+// UseNativeSSH reports whether to connect with the built in ssh client, as
+// chosen by the config's ssh_client, "native" or "openssh".  When it's not
+// set, the built in client is used if ssh isn't installed.
+func (rsc *RealSystemClient) UseNativeSSH() bool {
+	switch rsc.sshClient {
+	case "native":
+		return true
+	case "openssh":
+		return false
+	}
+
+	_, err := exec.LookPath("ssh")
+	return err != nil
+}
+
+func (rsc *RealSystemClient) RunNativeSSH(opts SSHConnectOpts) (int, error) {
+	return runNativeSSH(opts, os.Stdin, os.Stdout, os.Stderr)
 }
 
 func (rsc *RealSystemClient) CheckSSHPort(host string, port int64) error {
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
 	timeouts := []time.Duration{0, 200, 500, 1000, 2000}
 	var err error
 	var conn net.Conn
@@ -142,12 +570,12 @@ func (rsc *RealSystemClient) CheckSSHPort(host string, port int64) error {
 			continue
 		}
 
-		message, err := bufio.NewReader(conn).ReadString('\n')
-		logrus.Debugf("message: %s (%s)", message, err)
+		err = sshHandshake(conn, address)
 		conn.Close()
-		if strings.Contains(message, "SSH") {
+		if err == nil {
 			return nil
 		}
+		logrus.Debugf("error in ssh handshake: %s", err)
 	}
 
 	return errors.New("Unable to connect to SSH port on environment")
@@ -163,17 +591,31 @@ func (rsc *RealSystemClient) RunSSH(command string, args []string) error {
 	return cmd.Run()
 }
 
-func NewSystemClient() (*RealSystemClient, error) {
+func (rsc *RealSystemClient) ImageCatalog() ([]*BaseImage, error) {
+	if rsc.imageCatalog == nil {
+		catalog, err := LoadCatalogs(rsc.config)
+		if err != nil {
+			return nil, err
+		}
+		rsc.imageCatalog = catalog
+	}
+
+	return rsc.imageCatalog, nil
+}
+
+// NewSystemClient creates a system client for the user, using the choices
+// made in the user's config.
+func NewSystemClient(cfg Config) (*RealSystemClient, error) {
 
 	var home string
 	if home = os.Getenv(HOME_ENV_NAME); len(home) == 0 {
 		return nil, fmt.Errorf("$%s environment variable not found", HOME_ENV_NAME)
 	}
 
-	return NewSystemClientWithBase(filepath.Join(home, ENVS_DIR))
+	return NewSystemClientWithBase(filepath.Join(home, ENVS_DIR), cfg)
 }
 
-func NewSystemClientWithBase(baseDir string) (*RealSystemClient, error) {
+func NewSystemClientWithBase(baseDir string, cfg Config) (*RealSystemClient, error) {
 
 	var user string
 
@@ -200,6 +642,9 @@ func NewSystemClientWithBase(baseDir string) (*RealSystemClient, error) {
 		gid:       gid,
 		baseDir:   baseDir,
 		envRegexp: regexp.MustCompile(fmt.Sprintf("%s/(.*)dev", user)),
+		keyOpts:   cfg.SSHKeyOpts(),
+		sshClient: cfg.SSHClient,
+		config:    cfg,
 	}
 
 	err := os.MkdirAll(baseDir, 0700)
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,7 +19,7 @@ func TestSSHKey(t *testing.T) {
 	tempdir, _ := ioutil.TempDir("", "ddc")
 	defer os.RemoveAll(tempdir)
 
-	sc, _ := NewSystemClientWithBase(tempdir)
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
 
 	key1, err := sc.EnsureSSHKey()
 	assert.Nil(err)
@@ -36,9 +40,178 @@ func TestDir(t *testing.T) {
 	base := filepath.Join(tempdir, "skegs")
 	defer os.RemoveAll(tempdir)
 
-	sc, _ := NewSystemClientWithBase(base)
+	sc, _ := NewSystemClientWithBase(base, Config{})
 
 	path, err := sc.EnsureEnvironmentDir("foo")
 	assert.Nil(err)
 	assert.NotEmpty(path)
 }
+
+func TestForwards(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
+
+	forwards, err := sc.Forwards()
+	assert.Nil(err)
+	assert.Len(forwards, 0)
+
+	err = sc.SaveForwards([]Forward{{Env: "foo", HostPort: 8080, ContainerPort: 80, Pid: 1234}})
+	assert.Nil(err)
+
+	forwards, err = sc.Forwards()
+	assert.Nil(err)
+	assert.Equal([]Forward{{Env: "foo", HostPort: 8080, ContainerPort: 80, Pid: 1234}}, forwards)
+
+	// the forwards file isn't an environment
+	dirs, err := sc.EnvironmentDirs()
+	assert.Nil(err)
+	assert.Len(dirs, 0)
+}
+
+func TestKnownHosts(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
+
+	err := sc.SetKnownHost("skeg_nate_foo", "ssh-ed25519 AAAAfoo skeg host key foo\n")
+	assert.Nil(err)
+	err = sc.SetKnownHost("skeg_nate_bar", "ssh-ed25519 AAAAbar skeg host key bar\n")
+	assert.Nil(err)
+	err = sc.SetKnownHost("skeg_nate_foo", "ssh-ed25519 AAAAnew skeg host key foo\n")
+	assert.Nil(err)
+
+	data, _ := ioutil.ReadFile(sc.KnownHostsPath())
+	assert.Equal("skeg_nate_bar ssh-ed25519 AAAAbar\nskeg_nate_foo ssh-ed25519 AAAAnew\n", string(data))
+
+	err = sc.SetKnownHost("skeg_nate_bar", "")
+	assert.Nil(err)
+
+	data, _ = ioutil.ReadFile(sc.KnownHostsPath())
+	assert.Equal("skeg_nate_foo ssh-ed25519 AAAAnew\n", string(data))
+
+	err = sc.SetKnownHost("skeg_nate_foo", "bogus")
+	assert.Equal(errors.New("Invalid public key for skeg_nate_foo"), err)
+}
+
+func TestInstallSSHConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(filepath.Join(tempdir, "skegs"), Config{})
+	configPath := filepath.Join(tempdir, ".ssh", "config")
+
+	os.MkdirAll(filepath.Dir(configPath), 0700)
+	ioutil.WriteFile(configPath, []byte("Host example\n  User nate\n"), 0600)
+	assert.False(sc.SSHConfigInstalled())
+
+	err := sc.InstallSSHConfig()
+	assert.Nil(err)
+	err = sc.WriteSSHConfig("Host skeg-foo\n")
+	assert.Nil(err)
+	assert.True(sc.SSHConfigInstalled())
+
+	// installing again doesn't add a second Include
+	err = sc.InstallSSHConfig()
+	assert.Nil(err)
+
+	data, _ := ioutil.ReadFile(configPath)
+	assert.Equal("Include config.d/skeg\n\nHost example\n  User nate\n", string(data))
+
+	data, _ = ioutil.ReadFile(filepath.Join(tempdir, ".ssh", "config.d", "skeg"))
+	assert.Equal("Host skeg-foo\n", string(data))
+}
+
+func TestSSHKeyOpts(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
+
+	sc.keyOpts = SSHKeyOpts{Type: "ed25519"}
+	key, err := sc.EnsureSSHKey()
+	assert.Nil(err)
+	assert.Equal(filepath.Join(tempdir, "skeg_key_ed25519"), key.privatePath)
+	assert.Equal(filepath.Join(tempdir, "skeg_key_ed25519.pub"), key.publicPath)
+	assert.False(key.agent)
+
+	data, _ := ioutil.ReadFile(key.publicPath)
+	assert.True(strings.HasPrefix(string(data), "ssh-ed25519 "))
+
+	out, _ := exec.Command("ssh-keygen", "-l", "-E", "sha256", "-f", key.publicPath).Output()
+	fingerprint, err := KeyFingerprint(data)
+	assert.Nil(err)
+	assert.Equal(strings.Fields(string(out))[1], fingerprint)
+
+	sc.keyOpts = SSHKeyOpts{Type: "dsa"}
+	_, err = sc.EnsureSSHKey()
+	assert.Equal(errors.New("Unsupported ssh key type dsa, must be one of rsa, ed25519, ecdsa"), err)
+
+	sc.keyOpts = SSHKeyOpts{Path: key.privatePath}
+	existing, err := sc.EnsureSSHKey()
+	assert.Nil(err)
+	assert.Equal(key, existing)
+
+	sc.keyOpts = SSHKeyOpts{Path: filepath.Join(tempdir, "missing")}
+	_, err = sc.EnsureSSHKey()
+	assert.Equal(fmt.Errorf("SSH key %s not found", filepath.Join(tempdir, "missing")), err)
+
+	_, err = KeyFingerprint([]byte("bogus"))
+	assert.Equal(errors.New("Invalid public key"), err)
+}
+
+func TestCheckSSHKey(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
+
+	path, err := sc.CheckSSHKey()
+	assert.Equal(filepath.Join(tempdir, "skeg_key"), path)
+	assert.Equal(ErrSSHKeyNotCreated, err)
+
+	key, err := sc.EnsureSSHKey()
+	assert.Nil(err)
+	_, err = sc.CheckSSHKey()
+	assert.Nil(err)
+
+	os.Chmod(key.privatePath, 0644)
+	_, err = sc.CheckSSHKey()
+	assert.Equal(fmt.Errorf("SSH key %s is accessible by others (mode 0644)", key.privatePath), err)
+
+	sc.keyOpts = SSHKeyOpts{Path: filepath.Join(tempdir, "missing")}
+	_, err = sc.CheckSSHKey()
+	assert.Equal(fmt.Errorf("SSH key %s not found", filepath.Join(tempdir, "missing")), err)
+}
+
+func TestForwardRunning(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	sc, _ := NewSystemClientWithBase(tempdir, Config{})
+
+	// a process that got the pid of an exited forward isn't the forward
+	cmd := exec.Command("sleep", "10")
+	assert.Nil(cmd.Start())
+	defer cmd.Process.Kill()
+
+	forward := Forward{Env: "foo", HostPort: 8080, ContainerPort: 80, Pid: cmd.Process.Pid}
+	args, err := processCommand(forward.Pid)
+	assert.Nil(err)
+	assert.Equal([]string{"sleep", "10"}, args)
+	assert.False(sc.ForwardRunning(forward))
+}
@@ -0,0 +1,73 @@
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func (rsc *RealSystemClient) DockerSocketGID(path string) (int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("Unable to determine group of %s", path)
+	}
+
+	return int(stat.Gid), nil
+}
+
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+func processRunning(pid int) bool {
+	return syscall.Kill(pid, syscall.Signal(0)) == nil
+}
+
+// processCommand returns the command line of a process, from /proc where
+// there is one and from ps otherwise.
+func processCommand(pid int) ([]string, error) {
+	if _, err := os.Stat("/proc/self/cmdline"); err == nil {
+		data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+		if err != nil {
+			return nil, err
+		}
+
+		return strings.Split(string(bytes.TrimRight(data, "\x00")), "\x00"), nil
+	}
+
+	out, err := exec.Command("ps", "-o", "command=", "-p", fmt.Sprintf("%d", pid)).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(string(out)), nil
+}
+
+// watchWindowSize calls fn when the terminal is resized, until the returned
+// function is called.
+func watchWindowSize(fn func()) func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGWINCH)
+	go func() {
+		for range sigs {
+			fn()
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
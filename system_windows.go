@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func (rsc *RealSystemClient) DockerSocketGID(path string) (int, error) {
+	return 0, errors.New("Docker socket group detection not supported on windows")
+}
+
+func detachProcess(cmd *exec.Cmd) {
+}
+
+func processRunning(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	proc.Release()
+
+	return true
+}
+
+// processCommand returns the program of a process, windows doesn't offer its
+// arguments without WMI.
+func processCommand(pid int) ([]string, error) {
+	out, err := exec.Command("tasklist", "/FI", fmt.Sprintf("PID eq %d", pid), "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := csv.NewReader(strings.NewReader(string(out))).Read()
+	if err != nil || len(record) < 2 || record[1] != fmt.Sprintf("%d", pid) {
+		return nil, fmt.Errorf("Process %d not found", pid)
+	}
+
+	return record[:1], nil
+}
+
+func watchWindowSize(fn func()) func() {
+	return func() {}
+}
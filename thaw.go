@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type ThawCommand struct {
+	Args struct {
+		Archive string `description:"Archive created by freeze."`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var thawCommand ThawCommand
+
+func (x *ThawCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	return ThawEnvironment(dc, sc, thawCommand.Args.Archive, cfg.Mounts, os.Stdout)
+}
+
+func init() {
+	_, err := parser.AddCommand("thaw",
+		"Thaw a frozen environment.",
+		"",
+		&thawCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type UpCommand struct {
+	CreateCommand
+}
+
+var upCommand UpCommand
+
+func (x *UpCommand) Execute(args []string) error {
+	dc, err := NewDockerClient(globalOptions.toConnectOpts())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, err := NewSystemClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	co := upCommand.toCreateOpts(sc, workingDir)
+	co.Env, err = upCommand.toEnv()
+	if err != nil {
+		return err
+	}
+
+	co, err = ApplyProjectSpec(co)
+	if err != nil {
+		return err
+	}
+	if len(co.Name) == 0 {
+		co.Name = filepath.Base(co.ProjectDir)
+	}
+
+	envs, err := Environments(dc, sc)
+	if err != nil {
+		return err
+	}
+	if env, ok := envs[co.Name]; ok && env.Container != nil {
+		fmt.Printf("Starting existing environment %s\n", co.Name)
+		_, err = EnsureRunning(dc, sc, co.Name)
+		return err
+	}
+
+	return CreateNewEnvironment(dc, sc, cfg.MergeCreateOpts(co), os.Stdout)
+}
+
+func init() {
+	_, err := parser.AddCommand("up",
+		"Create or start the environment for a project.",
+		"Create or start the environment described by the .skeg.yml file in the project directory (defaults to $PWD).",
+		&upCommand)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds user level defaults for creating and building environments,
+// read from ~/.skeg/config.  Anything given on the command line takes
+// precedence over values found here.
+type Config struct {
+	Type       string   `yaml:"type"`
+	Version    string   `yaml:"version"`
+	Image      string   `yaml:"image"`
+	TimeZone   string   `yaml:"tz"`
+	Distro     string   `yaml:"distro"`
+	ForcePull  bool     `yaml:"force_pull"`
+	ForceBuild bool     `yaml:"force_build"`
+	Ports      []string `yaml:"ports"`
+	Volumes    []string `yaml:"volumes"`
+	VolumeHome bool     `yaml:"volume_home"`
+	Docker     bool     `yaml:"docker"`
+	CPUs       string   `yaml:"cpus"`
+	Memory     string   `yaml:"memory"`
+	MemorySwap string   `yaml:"memory_swap"`
+	PidsLimit  int64    `yaml:"pids_limit"`
+
+	Mounts   []MountOpts `yaml:"mounts"`
+	Catalogs []string    `yaml:"catalogs"`
+
+	SSHKeyType string `yaml:"ssh_key_type"`
+	SSHKey     string `yaml:"ssh_key"`
+	SSHAgent   bool   `yaml:"ssh_agent"`
+	SSHClient  string `yaml:"ssh_client"`
+
+	path string
+}
+
+type ConfigSetting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+func DefaultConfigPath() (string, error) {
+	var home string
+	if home = os.Getenv(HOME_ENV_NAME); len(home) == 0 {
+		return "", fmt.Errorf("$%s environment variable not found", HOME_ENV_NAME)
+	}
+
+	return filepath.Join(home, CONFIG_DIR, CONFIG_FILE), nil
+}
+
+// LoadConfig reads the config file at path.  A missing file is not an error,
+// it just results in an empty config.
+func LoadConfig(path string) (Config, error) {
+	cfg := Config{}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		logrus.Debugf("No config file found at %s", path)
+		return cfg, nil
+	} else if err != nil {
+		return cfg, err
+	}
+
+	err = yaml.UnmarshalStrict(data, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("Unable to parse config file %s: %s", path, err)
+	}
+	cfg.path = path
+
+	return cfg, nil
+}
+
+// expandHome expands a leading ~ in path to the user's home directory.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	var home string
+	if home = os.Getenv(HOME_ENV_NAME); len(home) == 0 {
+		return "", fmt.Errorf("$%s environment variable not found", HOME_ENV_NAME)
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+func loadConfig() (Config, error) {
+	path := globalOptions.Config
+	if len(path) == 0 {
+		var err error
+		path, err = DefaultConfigPath()
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	return LoadConfig(path)
+}
+
+// SSHKeyOpts returns the configured choice of ssh key.
+func (cfg Config) SSHKeyOpts() SSHKeyOpts {
+	return SSHKeyOpts{
+		Type:  cfg.SSHKeyType,
+		Path:  cfg.SSHKey,
+		Agent: cfg.SSHAgent,
+	}
+}
+
+// MergeBuildOpts fills in build options that weren't specified on the command
+// line.  The image options are treated as a group, so specifying an image or
+// type on the command line ignores the configured image and type.
+func (cfg Config) MergeBuildOpts(bo BuildOpts) BuildOpts {
+	if len(bo.Image.Type) == 0 && len(bo.Image.Image) == 0 {
+		bo.Image.Type = cfg.Type
+		bo.Image.Image = cfg.Image
+		if len(bo.Image.Version) == 0 {
+			bo.Image.Version = cfg.Version
+		}
+	}
+
+	if len(bo.TimeZone) == 0 {
+		bo.TimeZone = cfg.TimeZone
+	}
+
+	if len(bo.Distro) == 0 {
+		bo.Distro = cfg.Distro
+	}
+
+	bo.ForcePull = bo.ForcePull || cfg.ForcePull
+
+	return bo
+}
+
+// MergeCreateOpts fills in create options that weren't specified on the
+// command line.
+func (cfg Config) MergeCreateOpts(co CreateOpts) CreateOpts {
+	co.Build = cfg.MergeBuildOpts(co.Build)
+
+	if len(co.Ports) == 0 {
+		co.Ports = cfg.Ports
+	}
+
+	if len(co.Volumes) == 0 {
+		co.Volumes = cfg.Volumes
+	}
+
+	co.Mounts = append(cfg.Mounts, co.Mounts...)
+	co.VolumeHome = co.VolumeHome || cfg.VolumeHome
+	co.DockerSocket = co.DockerSocket || cfg.Docker
+	co.ForceBuild = co.ForceBuild || cfg.ForceBuild || co.Build.ForcePull
+	co.Resources = co.Resources.Merge(ResourceOpts{
+		CPUs:       cfg.CPUs,
+		Memory:     cfg.Memory,
+		MemorySwap: cfg.MemorySwap,
+		PidsLimit:  cfg.PidsLimit,
+	})
+
+	return co
+}
+
+// Settings describes each value that would be used to create an environment
+// with the given command line options, along with where it came from.
+func (cfg Config) Settings(sc SystemClient, co CreateOpts) []ConfigSetting {
+	merged := cfg.MergeCreateOpts(co)
+
+	source := func(flag, value string) string {
+		if len(flag) > 0 {
+			return "flag"
+		} else if len(value) > 0 {
+			return fmt.Sprintf("config (%s)", cfg.path)
+		}
+		return "default"
+	}
+
+	setting := func(name, flag, value, def string) ConfigSetting {
+		src := source(flag, value)
+		if len(value) == 0 {
+			value = def
+		}
+		return ConfigSetting{name, value, src}
+	}
+
+	boolString := func(b bool) string {
+		if b {
+			return "true"
+		}
+		return ""
+	}
+
+	pidsString := func(n int64) string {
+		if n > 0 {
+			return fmt.Sprintf("%d", n)
+		}
+		return ""
+	}
+
+	mounts := make([]string, 0)
+	for _, mount := range merged.Mounts {
+		mounts = append(mounts, fmt.Sprintf("%s:%s:%s", mount.Source, mount.Target, mount.Mode))
+	}
+
+	tz := sc.DetectTimeZone()
+	if len(tz) > 0 {
+		tz = fmt.Sprintf("%s (detected)", tz)
+	}
+
+	return []ConfigSetting{
+		setting("type", co.Build.Image.Type, merged.Build.Image.Type, ""),
+		setting("version", co.Build.Image.Version, merged.Build.Image.Version, "(preferred)"),
+		setting("image", co.Build.Image.Image, merged.Build.Image.Image, ""),
+		setting("tz", co.Build.TimeZone, merged.Build.TimeZone, tz),
+		setting("distro", co.Build.Distro, merged.Build.Distro, "(detected)"),
+		setting("force_pull", boolString(co.Build.ForcePull), boolString(merged.Build.ForcePull), "false"),
+		setting("force_build", boolString(co.ForceBuild), boolString(merged.ForceBuild), "false"),
+		setting("ports", strings.Join(co.Ports, ", "), strings.Join(merged.Ports, ", "), ""),
+		setting("volumes", strings.Join(co.Volumes, ", "), strings.Join(merged.Volumes, ", "), ""),
+		setting("volume_home", boolString(co.VolumeHome), boolString(merged.VolumeHome), "false"),
+		setting("docker", boolString(co.DockerSocket), boolString(merged.DockerSocket), "false"),
+		setting("cpus", co.Resources.CPUs, merged.Resources.CPUs, "(unlimited)"),
+		setting("memory", co.Resources.Memory, merged.Resources.Memory, "(unlimited)"),
+		setting("memory_swap", co.Resources.MemorySwap, merged.Resources.MemorySwap, "(unlimited)"),
+		setting("pids_limit", pidsString(co.Resources.PidsLimit), pidsString(merged.Resources.PidsLimit), "(unlimited)"),
+		setting("mounts", "", strings.Join(mounts, ", "), ""),
+		setting("catalogs", "", strings.Join(cfg.Catalogs, ", "), ""),
+		setting("ssh_key_type", "", cfg.SSHKeyType, "rsa"),
+		setting("ssh_key", "", cfg.SSHKey, ""),
+		setting("ssh_agent", "", boolString(cfg.SSHAgent), "false"),
+		setting("ssh_client", "", cfg.SSHClient, "(openssh if installed)"),
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	tempdir, _ := ioutil.TempDir("", "ddc")
+	defer os.RemoveAll(tempdir)
+
+	path := filepath.Join(tempdir, "config")
+
+	cfg, err := LoadConfig(path)
+	assert.Nil(err)
+	assert.Equal(Config{}, cfg)
+
+	ioutil.WriteFile(path, []byte(`
+type: go
+version: "1.8"
+tz: America/Chicago
+ports:
+  - "8080:8080"
+volume_home: true
+`), 0644)
+
+	cfg, err = LoadConfig(path)
+	assert.Nil(err)
+	assert.Equal("go", cfg.Type)
+	assert.Equal("1.8", cfg.Version)
+	assert.Equal("America/Chicago", cfg.TimeZone)
+	assert.Equal([]string{"8080:8080"}, cfg.Ports)
+	assert.True(cfg.VolumeHome)
+
+	ioutil.WriteFile(path, []byte("tipe: go\n"), 0644)
+	_, err = LoadConfig(path)
+	assert.NotNil(err)
+}
+
+func TestMergeCreateOpts(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := Config{
+		Type:     "go",
+		Version:  "1.8",
+		TimeZone: "America/Chicago",
+		Ports:    []string{"8080:8080"},
+		Volumes:  []string{"/tmp:/tmp"},
+	}
+
+	co := cfg.MergeCreateOpts(CreateOpts{Name: "foo"})
+	assert.Equal(ImageOpts{Type: "go", Version: "1.8"}, co.Build.Image)
+	assert.Equal("America/Chicago", co.Build.TimeZone)
+	assert.Equal([]string{"8080:8080"}, co.Ports)
+	assert.Equal([]string{"/tmp:/tmp"}, co.Volumes)
+	assert.False(co.ForceBuild)
+
+	co = cfg.MergeCreateOpts(CreateOpts{
+		Name:  "foo",
+		Ports: []string{"3000"},
+		Build: BuildOpts{
+			Image:     ImageOpts{Image: "ubuntu:16.04"},
+			TimeZone:  "UTC",
+			ForcePull: true,
+		},
+	})
+	assert.Equal(ImageOpts{Image: "ubuntu:16.04"}, co.Build.Image)
+	assert.Equal("UTC", co.Build.TimeZone)
+	assert.Equal([]string{"3000"}, co.Ports)
+	assert.True(co.ForceBuild)
+
+	co = cfg.MergeCreateOpts(CreateOpts{
+		Build: BuildOpts{Image: ImageOpts{Version: "1.7"}},
+	})
+	assert.Equal(ImageOpts{Type: "go", Version: "1.7"}, co.Build.Image)
+
+	sc := NewTestSystemClient()
+	settings := make(map[string]ConfigSetting)
+	for _, setting := range cfg.Settings(sc, CreateOpts{Ports: []string{"3000"}}) {
+		settings[setting.Name] = setting
+	}
+	assert.Equal(ConfigSetting{"type", "go", "config ()"}, settings["type"])
+	assert.Equal(ConfigSetting{"image", "", "default"}, settings["image"])
+	assert.Equal(ConfigSetting{"ports", "3000", "flag"}, settings["ports"])
+	assert.Equal(ConfigSetting{"memory", "(unlimited)", "default"}, settings["memory"])
+
+	// resource limits from the config are defaults for each limit
+	cfg.CPUs = "2"
+	cfg.Memory = "4g"
+	co = cfg.MergeCreateOpts(CreateOpts{Resources: ResourceOpts{Memory: "8g", PidsLimit: 512}})
+	assert.Equal(ResourceOpts{CPUs: "2", Memory: "8g", PidsLimit: 512}, co.Resources)
+}